@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var serveAlertmanagerCmd = &cobra.Command{
+	Use:   "alertmanager [server]",
+	Short: "Receive Prometheus Alertmanager webhooks and post the alerts",
+	Long: `Receive Prometheus Alertmanager webhooks and post the alerts.
+
+Point an Alertmanager webhook receiver at http://host:9095/, sending the
+secret given to --secret as its bearer token or basic auth password. Alerts go
+to the channels of the first matching route in the routes file, or to the
+channels given with -c.`,
+	RunE: doServeAlertmanagerCmdF,
+}
+
+func init() {
+	serveAlertmanagerCmd.Flags().String("listen", ":9095", "Address to listen on")
+	serveAlertmanagerCmd.Flags().String("routes", "", "TOML file of label matchers and the channels to post matching alerts to")
+	serveAlertmanagerCmd.Flags().Bool("upsert", false, "Update the post for an alert group instead of posting again when it changes or resolves")
+	serveAlertmanagerCmd.Flags().String("secret", "", "Bearer token or basic auth password Alertmanager must send, required")
+	serveAlertmanagerCmd.Flags().Int("max-alerts", 20, "The most alerts to show cards for in a post")
+	serveAlertmanagerCmd.Flags().String("state", "", "File to save the post for each alert group to with --upsert, so updates survive restarts")
+
+	serveCmd.AddCommand(serveAlertmanagerCmd)
+}
+
+const (
+	ALERT_FIRING   = "firing"
+	ALERT_RESOLVED = "resolved"
+)
+
+// alertRetryWindow is how long a notification counts as delivered to a
+// channel, so that when Alertmanager retries it after another channel failed
+// the channels that got it don't get it again.
+const alertRetryWindow = 10 * time.Minute
+
+// alertmanagerMessage is the body of an Alertmanager webhook.
+type alertmanagerMessage struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []*alert          `json:"alerts"`
+}
+
+type alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// alertRoutes sends alerts to channels by their labels, like:
+//
+//	[[route]]
+//	match = { severity = "critical" }
+//	match_re = { service = "^(api|web)$" }
+//	team = "ops"
+//	channels = ["oncall"]
+//	continue = true
+type alertRoutes struct {
+	Routes []*alertRoute `toml:"route"`
+}
+
+type alertRoute struct {
+	Match    map[string]string `toml:"match"`
+	MatchRe  map[string]string `toml:"match_re"`
+	Team     string            `toml:"team"`
+	Channels []string          `toml:"channels"`
+	Continue bool              `toml:"continue"`
+
+	matchRe map[string]*regexp.Regexp
+}
+
+func readAlertRoutes(filename string) ([]*alertRoute, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed alertRoutes
+	if err := toml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("Unable to read routes %v: %v", filename, err.Error())
+	}
+
+	for i, route := range parsed.Routes {
+		if len(route.Channels) == 0 {
+			return nil, fmt.Errorf("Route %v in %v has no channels", i+1, filename)
+		}
+
+		route.matchRe = map[string]*regexp.Regexp{}
+		for label, pattern := range route.MatchRe {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pattern for %v in route %v: %v", label, i+1, err.Error())
+			}
+			route.matchRe[label] = re
+		}
+	}
+
+	return parsed.Routes, nil
+}
+
+func (route *alertRoute) matches(labels map[string]string) bool {
+	for label, value := range route.Match {
+		if labels[label] != value {
+			return false
+		}
+	}
+	for label, re := range route.matchRe {
+		if !re.MatchString(labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// alertmanagerServer posts the alerts from Alertmanager webhooks.
+type alertmanagerServer struct {
+	session   *serveSession
+	routes    []*alertRoute
+	defaults  []*postTarget
+	upsert    bool
+	secret    string
+	maxAlerts int
+	stateFile string
+	cmd       *cobra.Command
+
+	// The post for each alert group in each channel, for --upsert, and when
+	// each notification was delivered to each channel
+	mutex     sync.Mutex
+	posts     map[string]string
+	delivered map[string]time.Time
+}
+
+func doServeAlertmanagerCmdF(cmd *cobra.Command, args []string) error {
+	routesFile, _ := cmd.Flags().GetString("routes")
+	upsert, _ := cmd.Flags().GetBool("upsert")
+	secret, _ := cmd.Flags().GetString("secret")
+	maxAlerts, _ := cmd.Flags().GetInt("max-alerts")
+	stateFile, _ := cmd.Flags().GetString("state")
+	channels, _ := cmd.Flags().GetStringArray("channel")
+	teamName, _ := cmd.Flags().GetString("team")
+
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	var routes []*alertRoute
+	if routesFile != "" {
+		var err error
+		if routes, err = readAlertRoutes(routesFile); err != nil {
+			return err
+		}
+	}
+
+	if len(routes) == 0 && len(channels) == 0 {
+		return fmt.Errorf("Need a channel or routes file")
+	}
+
+	if secret == "" {
+		return fmt.Errorf("Need a --secret to check webhooks with")
+	}
+
+	if stateFile != "" && !upsert {
+		return fmt.Errorf("--state is only used with --upsert")
+	}
+
+	server := &alertmanagerServer{
+		routes:    routes,
+		upsert:    upsert,
+		secret:    secret,
+		maxAlerts: maxAlerts,
+		stateFile: stateFile,
+		cmd:       cmd,
+		posts:     map[string]string{},
+		delivered: map[string]time.Time{},
+	}
+
+	if stateFile != "" {
+		data, err := ioutil.ReadFile(stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &server.posts); err != nil {
+				return fmt.Errorf("Unable to read state file %v: %v", stateFile, err.Error())
+			}
+		}
+	}
+
+	session, err := newServeSession(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	server.session = session
+
+	for _, channel := range channels {
+		server.defaults = append(server.defaults, &postTarget{Server: args[0], Team: teamName, Channel: channel})
+	}
+
+	return listenAndServe(cmd, server)
+}
+
+func (s *alertmanagerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkBearerToken(r, s.secret) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	message := &alertmanagerMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.postAlerts(message); err != nil {
+		fmt.Println("Unable to post alerts for " + message.GroupKey)
+		fmt.Println(" Error: " + err.Error())
+
+		// Alertmanager retries failed notifications
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// route returns the channels the alert goes to.
+func (s *alertmanagerServer) route(a *alert) []*postTarget {
+	var targets []*postTarget
+	for _, route := range s.routes {
+		if !route.matches(a.Labels) {
+			continue
+		}
+		for _, channel := range route.Channels {
+			targets = append(targets, &postTarget{Server: s.session.server, Team: route.Team, Channel: channel})
+		}
+		if !route.Continue {
+			return targets
+		}
+	}
+
+	if len(targets) == 0 {
+		return s.defaults
+	}
+	return targets
+}
+
+// postAlerts posts the group's alerts to each channel they route to. Channels
+// that recently got the same notification are skipped, so when Alertmanager
+// retries after some channels failed the others don't get it twice.
+func (s *alertmanagerServer) postAlerts(message *alertmanagerMessage) error {
+	type channelAlerts struct {
+		target *postTarget
+		alerts []*alert
+	}
+
+	var order []string
+	byChannel := map[string]*channelAlerts{}
+	for _, a := range message.Alerts {
+		for _, target := range s.route(a) {
+			key := target.Team + "/" + target.Channel
+			if byChannel[key] == nil {
+				byChannel[key] = &channelAlerts{target: target}
+				order = append(order, key)
+			}
+			byChannel[key].alerts = append(byChannel[key].alerts, a)
+		}
+	}
+
+	if len(order) == 0 {
+		fmt.Println("No route for alert group " + message.GroupKey)
+		return nil
+	}
+
+	s.mutex.Lock()
+	for key, at := range s.delivered {
+		if time.Since(at) > alertRetryWindow {
+			delete(s.delivered, key)
+		}
+	}
+	s.mutex.Unlock()
+
+	// Every channel is tried even when one fails, and Alertmanager's retry
+	// only goes to the channels that failed
+	var failed error
+	for _, key := range order {
+		group := byChannel[key]
+
+		channel, err := s.session.lookupChannel(group.target.Channel, group.target.Team)
+		if err != nil {
+			failed = err
+			continue
+		}
+
+		post := s.renderAlerts(message, group.alerts)
+		post.ChannelId = channel.Id
+
+		postKey := message.GroupKey + "\x00" + channel.Id
+		deliveredKey := postKey + "\x00" + post.ToJson()
+
+		s.mutex.Lock()
+		_, done := s.delivered[deliveredKey]
+		s.mutex.Unlock()
+		if done {
+			continue
+		}
+
+		if err := s.postGroup(postKey, post, group.alerts, message.GroupKey); err != nil {
+			failed = err
+			continue
+		}
+
+		s.mutex.Lock()
+		s.delivered[deliveredKey] = time.Now()
+		s.mutex.Unlock()
+	}
+
+	return failed
+}
+
+// postGroup posts the group's alerts to a channel, or with --upsert updates the
+// post made for the group before.
+func (s *alertmanagerServer) postGroup(postKey string, post *model.Post, alerts []*alert, groupKey string) error {
+	resolved := true
+	for _, a := range alerts {
+		if a.Status != ALERT_RESOLVED {
+			resolved = false
+		}
+	}
+
+	if s.upsert {
+		s.mutex.Lock()
+		postId := s.posts[postKey]
+		s.mutex.Unlock()
+
+		if postId != "" {
+			_, err := s.session.patchPost(postId, &model.PostPatch{Message: &post.Message, Props: &post.Props})
+			if err == nil {
+				if resolved {
+					s.forgetPost(postKey)
+				}
+				return nil
+			}
+			if isUnreachable(err) {
+				return err
+			}
+			// The post may have been deleted, so post it again
+			fmt.Println("Unable to update the post for " + groupKey + ", posting again")
+			fmt.Println(" Error: " + err.Error())
+		}
+	}
+
+	created, err := s.session.createPost(post, nil)
+	if err != nil {
+		return err
+	}
+
+	if s.upsert && !resolved {
+		s.rememberPost(postKey, created.Id)
+	}
+
+	return nil
+}
+
+func (s *alertmanagerServer) rememberPost(postKey string, postId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.posts[postKey] = postId
+	s.saveState()
+}
+
+func (s *alertmanagerServer) forgetPost(postKey string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.posts, postKey)
+	s.saveState()
+}
+
+// saveState saves the posts to the state file, if there is one. The caller
+// holds the mutex.
+func (s *alertmanagerServer) saveState() {
+	if s.stateFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.posts, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.stateFile, data)
+	}
+	if err != nil {
+		fmt.Println("Unable to save state file " + s.stateFile)
+		fmt.Println(" Error: " + err.Error())
+	}
+}
+
+// renderAlerts builds a post with a card for each alert.
+func (s *alertmanagerServer) renderAlerts(message *alertmanagerMessage, alerts []*alert) *model.Post {
+	firing := 0
+	for _, a := range alerts {
+		if a.Status == ALERT_FIRING {
+			firing++
+		}
+	}
+
+	status := ALERT_RESOLVED
+	if firing != 0 {
+		status = ALERT_FIRING
+	}
+
+	title := "**[" + strings.ToUpper(status)
+	if firing != 0 {
+		title += fmt.Sprintf(":%v", firing)
+	}
+	title += "]** " + formatLabels(message.GroupLabels)
+	if message.ExternalURL != "" {
+		title += " ([Alertmanager](" + message.ExternalURL + "))"
+	}
+
+	var cards []*model.SlackAttachment
+	for i, a := range alerts {
+		if i >= s.maxAlerts {
+			cards = append(cards, &model.SlackAttachment{
+				Fallback: fmt.Sprintf("and %v more alerts", len(alerts)-s.maxAlerts),
+				Text:     fmt.Sprintf("and %v more alerts", len(alerts)-s.maxAlerts),
+			})
+			break
+		}
+		cards = append(cards, alertCard(a))
+	}
+
+	post := &model.Post{
+		Message: title,
+		Type:    model.POST_DEFAULT,
+	}
+	setOverrideProps(s.cmd, post)
+	post.AddProp("attachments", cards)
+
+	return post
+}
+
+// alertCard shows one alert, red while it's firing and green once resolved.
+func alertCard(a *alert) *model.SlackAttachment {
+	color := "#a30200"
+	if a.Status == ALERT_RESOLVED {
+		color = "#2eb886"
+	}
+
+	name := a.Labels["alertname"]
+	if name == "" {
+		name = "Alert"
+	}
+
+	text := a.Annotations["summary"]
+	if description := a.Annotations["description"]; description != "" {
+		if text != "" {
+			text += "\n"
+		}
+		text += description
+	}
+
+	var fields []*model.SlackAttachmentField
+	var labels []string
+	for label := range a.Labels {
+		if label != "alertname" {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fields = append(fields, &model.SlackAttachmentField{Title: label, Value: a.Labels[label], Short: true})
+	}
+
+	since := "Started " + a.StartsAt.Format("2006-01-02 15:04:05 MST")
+	if a.Status == ALERT_RESOLVED && !a.EndsAt.IsZero() {
+		since += ", resolved " + a.EndsAt.Format("2006-01-02 15:04:05 MST")
+	}
+
+	return &model.SlackAttachment{
+		Fallback:  "[" + strings.ToUpper(a.Status) + "] " + name,
+		Color:     color,
+		Title:     "[" + strings.ToUpper(a.Status) + "] " + name,
+		TitleLink: a.GeneratorURL,
+		Text:      text,
+		Fields:    fields,
+		Footer:    since,
+	}
+}
+
+// formatLabels shows labels as name=value pairs in a stable order.
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for label, value := range labels {
+		pairs = append(pairs, label+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+const testAlertmanagerPayload = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"DiskFull\"}",
+  "status": "firing",
+  "receiver": "mattermost",
+  "groupLabels": {"alertname": "DiskFull", "env": "prod"},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "DiskFull", "instance": "db1", "env": "prod"},
+      "annotations": {"summary": "Disk is full", "description": "/var is at 99%"},
+      "startsAt": "2026-01-02T03:04:05Z",
+      "generatorURL": "http://prometheus:9090/graph"
+    },
+    {
+      "status": "resolved",
+      "labels": {"alertname": "DiskFull", "instance": "db2", "env": "prod"},
+      "annotations": {"description": "/var is fine"},
+      "startsAt": "2026-01-02T03:04:05Z",
+      "endsAt": "2026-01-02T04:00:00Z"
+    },
+    {
+      "status": "firing",
+      "labels": {"instance": "db3"},
+      "startsAt": "2026-01-02T03:04:05Z"
+    }
+  ]
+}`
+
+func TestRenderAlerts(t *testing.T) {
+	message := &alertmanagerMessage{}
+	if err := json.Unmarshal([]byte(testAlertmanagerPayload), message); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name      string
+		alerts    []*alert
+		maxAlerts int
+		title     string
+		cards     []string
+	}{
+		{
+			name:      "firing",
+			alerts:    message.Alerts,
+			maxAlerts: 20,
+			title:     "**[FIRING:2]** alertname=DiskFull env=prod ([Alertmanager](http://alertmanager:9093))",
+			cards:     []string{"[FIRING] DiskFull", "[RESOLVED] DiskFull", "[FIRING] Alert"},
+		},
+		{
+			name:      "resolved",
+			alerts:    message.Alerts[1:2],
+			maxAlerts: 20,
+			title:     "**[RESOLVED]** alertname=DiskFull env=prod ([Alertmanager](http://alertmanager:9093))",
+			cards:     []string{"[RESOLVED] DiskFull"},
+		},
+		{
+			name:      "too many",
+			alerts:    message.Alerts,
+			maxAlerts: 1,
+			title:     "**[FIRING:2]** alertname=DiskFull env=prod ([Alertmanager](http://alertmanager:9093))",
+			cards:     []string{"[FIRING] DiskFull", "and 2 more alerts"},
+		},
+	} {
+		cmd := &cobra.Command{Use: "test"}
+		addPostingFlags(cmd)
+		if err := cmd.ParseFlags([]string{"--as-username", "alertmanager"}); err != nil {
+			t.Fatal(err)
+		}
+
+		server := &alertmanagerServer{maxAlerts: test.maxAlerts, cmd: cmd}
+		post := server.renderAlerts(message, test.alerts)
+
+		if post.Message != test.title {
+			t.Errorf("%v: got title %q, want %q", test.name, post.Message, test.title)
+		}
+		if post.Props["override_username"] != "alertmanager" {
+			t.Errorf("%v: got props %v, want the username override", test.name, post.Props)
+		}
+
+		cards, _ := post.Props["attachments"].([]*model.SlackAttachment)
+		var fallbacks []string
+		for _, card := range cards {
+			fallbacks = append(fallbacks, card.Fallback)
+		}
+		if strings.Join(fallbacks, "|") != strings.Join(test.cards, "|") {
+			t.Errorf("%v: got cards %q, want %q", test.name, fallbacks, test.cards)
+		}
+	}
+}
+
+func TestAlertCard(t *testing.T) {
+	message := &alertmanagerMessage{}
+	if err := json.Unmarshal([]byte(testAlertmanagerPayload), message); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		alert  *alert
+		color  string
+		text   string
+		fields string
+		footer string
+	}{
+		{message.Alerts[0], "#a30200", "Disk is full\n/var is at 99%", "env=prod instance=db1", "Started 2026-01-02 03:04:05 UTC"},
+		{message.Alerts[1], "#2eb886", "/var is fine", "env=prod instance=db2", "Started 2026-01-02 03:04:05 UTC, resolved 2026-01-02 04:00:00 UTC"},
+		{message.Alerts[2], "#a30200", "", "instance=db3", "Started 2026-01-02 03:04:05 UTC"},
+	} {
+		card := alertCard(test.alert)
+
+		var fields []string
+		for _, field := range card.Fields {
+			fields = append(fields, field.Title+"="+field.Value.(string))
+		}
+
+		if card.Color != test.color || card.Text != test.text || strings.Join(fields, " ") != test.fields || card.Footer != test.footer {
+			t.Errorf("%v: got %v %q %v %q, want %v %q %v %q", card.Title, card.Color, card.Text, fields, card.Footer, test.color, test.text, test.fields, test.footer)
+		}
+	}
+}
+
+func TestAlertRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "routes.toml")
+	routes := `
+[[route]]
+match = { severity = "critical" }
+team = "ops"
+channels = ["oncall"]
+continue = true
+
+[[route]]
+match_re = { service = "^(api|web)$" }
+channels = ["web"]
+
+[[route]]
+match = { severity = "critical" }
+channels = ["never"]
+`
+	if err := ioutil.WriteFile(filename, []byte(routes), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &alertmanagerServer{
+		session:  &serveSession{server: "https://chat.example.com"},
+		defaults: []*postTarget{{Channel: "alerts"}},
+	}
+	if server.routes, err = readAlertRoutes(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		labels   map[string]string
+		channels string
+	}{
+		{map[string]string{"severity": "critical", "service": "api"}, "ops/oncall /web"},
+		{map[string]string{"severity": "critical", "service": "db"}, "ops/oncall /never"},
+		{map[string]string{"service": "web"}, "/web"},
+		{map[string]string{"service": "webhooks"}, "/alerts"},
+		{nil, "/alerts"},
+	} {
+		var channels []string
+		for _, target := range server.route(&alert{Labels: test.labels}) {
+			channels = append(channels, target.Team+"/"+target.Channel)
+		}
+		if strings.Join(channels, " ") != test.channels {
+			t.Errorf("%v: got %v, want %v", test.labels, channels, test.channels)
+		}
+	}
+
+	for _, routes := range []string{"[[route]]\nteam = \"ops\"\n", "[[route]]\nmatch_re = { a = \"(\" }\nchannels = [\"x\"]\n"} {
+		if err := ioutil.WriteFile(filename, []byte(routes), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readAlertRoutes(filename); err == nil {
+			t.Errorf("%q: got no error", routes)
+		}
+	}
+}
+
+func TestCheckBearerToken(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		secret string
+		header string
+		ok     bool
+	}{
+		{"bearer", "s3cret", "Bearer s3cret", true},
+		{"wrong bearer", "s3cret", "Bearer guess", false},
+		{"basic", "s3cret", "Basic " + basicAuth("alertmanager", "s3cret"), true},
+		{"wrong basic", "s3cret", "Basic " + basicAuth("alertmanager", "guess"), false},
+		{"missing", "s3cret", "", false},
+		{"empty bearer", "s3cret", "Bearer ", false},
+		{"no secret", "", "", false},
+		{"no secret with empty password", "", "Basic " + basicAuth("alertmanager", ""), false},
+	} {
+		r, _ := http.NewRequest("POST", "http://localhost:9095/", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		if ok := checkBearerToken(r, test.secret); ok != test.ok {
+			t.Errorf("%v: got %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+func basicAuth(username string, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestServeAlertmanagerNeedsSecret(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().AddFlagSet(serveAlertmanagerCmd.Flags())
+	cmd.Flags().StringArray("channel", nil, "")
+	cmd.Flags().String("team", "", "")
+	if err := cmd.ParseFlags([]string{"--channel", "alerts"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doServeAlertmanagerCmdF(cmd, []string{"https://chat.example.com"}); err == nil || !strings.Contains(err.Error(), "--secret") {
+		t.Errorf("got %v, want an error about --secret", err)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+const (
+	ANSI_STRIP  = "strip"
+	ANSI_RENDER = "render"
+)
+
+// ansiColors are the xterm colors for the 16 basic ANSI color codes.
+var ansiColors = []string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+type ansiStyle struct {
+	bold       bool
+	italic     bool
+	underline  bool
+	foreground string
+	background string
+}
+
+// ansiSegment is a run of text with the same style.
+type ansiSegment struct {
+	text  string
+	style ansiStyle
+}
+
+// parseAnsi splits terminal output into styled segments, dropping escape
+// codes it doesn't use for styling. Lines overwritten with a carriage return,
+// like progress bars, keep only their last version.
+func parseAnsi(text string) []ansiSegment {
+	var segments []ansiSegment
+	var current strings.Builder
+	style := ansiStyle{}
+
+	flush := func() {
+		if current.Len() != 0 {
+			segments = append(segments, ansiSegment{current.String(), style})
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if c == '\r' {
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			// Drop what was written to this line so far
+			flush()
+			segments = dropToLineStart(segments)
+			continue
+		}
+
+		if c != 0x1b || i+1 >= len(text) {
+			current.WriteByte(c)
+			continue
+		}
+
+		switch text[i+1] {
+		case '[':
+			// Control sequence: parameters then a final byte from @ to ~
+			end := i + 2
+			for end < len(text) && (text[end] < 0x40 || text[end] > 0x7e) {
+				end++
+			}
+			if end >= len(text) {
+				i = len(text)
+				continue
+			}
+			if text[end] == 'm' {
+				flush()
+				style = applySgr(style, text[i+2:end])
+			}
+			i = end
+		case ']':
+			// Operating system command, ended by BEL or ESC \
+			end := i + 2
+			for end < len(text) && text[end] != 0x07 && !(text[end] == 0x1b && end+1 < len(text) && text[end+1] == '\\') {
+				end++
+			}
+			if end < len(text) && text[end] == 0x1b {
+				end++
+			}
+			i = end
+		case '(', ')', '*', '+':
+			// Character set selection takes one more byte
+			i += 2
+		default:
+			i++
+		}
+	}
+	flush()
+
+	return segments
+}
+
+// dropToLineStart removes the text after the last newline from the segments.
+func dropToLineStart(segments []ansiSegment) []ansiSegment {
+	for len(segments) != 0 {
+		last := &segments[len(segments)-1]
+		if newline := strings.LastIndex(last.text, "\n"); newline != -1 {
+			last.text = last.text[:newline+1]
+			return segments
+		}
+		segments = segments[:len(segments)-1]
+	}
+	return segments
+}
+
+// applySgr updates the style with the parameters of a Select Graphic
+// Rendition sequence.
+func applySgr(style ansiStyle, params string) ansiStyle {
+	if params == "" {
+		return ansiStyle{}
+	}
+
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case code == 0:
+			style = ansiStyle{}
+		case code == 1:
+			style.bold = true
+		case code == 3:
+			style.italic = true
+		case code == 4:
+			style.underline = true
+		case code == 22:
+			style.bold = false
+		case code == 23:
+			style.italic = false
+		case code == 24:
+			style.underline = false
+		case code >= 30 && code <= 37:
+			style.foreground = ansiColors[code-30]
+		case code >= 90 && code <= 97:
+			style.foreground = ansiColors[code-90+8]
+		case code == 39:
+			style.foreground = ""
+		case code >= 40 && code <= 47:
+			style.background = ansiColors[code-40]
+		case code >= 100 && code <= 107:
+			style.background = ansiColors[code-100+8]
+		case code == 49:
+			style.background = ""
+		case code == 38 || code == 48:
+			color, used := extendedColor(codes[i+1:])
+			i += used
+			if code == 38 {
+				style.foreground = color
+			} else {
+				style.background = color
+			}
+		}
+	}
+
+	return style
+}
+
+// extendedColor reads a 256 color (5;n) or true color (2;r;g;b) parameter,
+// returning the color and how many parameters it used.
+func extendedColor(codes []string) (string, int) {
+	if len(codes) >= 2 && codes[0] == "5" {
+		n, _ := strconv.Atoi(codes[1])
+		return xterm256Color(n), 2
+	}
+
+	if len(codes) >= 4 && codes[0] == "2" {
+		r, _ := strconv.Atoi(codes[1])
+		g, _ := strconv.Atoi(codes[2])
+		b, _ := strconv.Atoi(codes[3])
+		return fmt.Sprintf("#%02x%02x%02x", r&0xff, g&0xff, b&0xff), 4
+	}
+
+	return "", len(codes)
+}
+
+func xterm256Color(n int) string {
+	switch {
+	case n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return ansiColors[n]
+	case n >= 232:
+		gray := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+	}
+
+	n -= 16
+	levels := []int{0, 95, 135, 175, 215, 255}
+	return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+}
+
+// stripAnsi removes escape codes from terminal output.
+func stripAnsi(text string) string {
+	var stripped strings.Builder
+	for _, segment := range parseAnsi(text) {
+		stripped.WriteString(segment.text)
+	}
+	return stripped.String()
+}
+
+// ansiToMarkdown turns bold and colored text into Markdown bold, and italic
+// and underlined text into Markdown italics. Markdown has no colors, so
+// emphasis is the closest thing to the highlighting a terminal would show.
+func ansiToMarkdown(text string) string {
+	var rendered strings.Builder
+	for _, segment := range parseAnsi(text) {
+		marker := ""
+		if segment.style.bold || segment.style.foreground != "" {
+			marker += "**"
+		}
+		if segment.style.italic || segment.style.underline {
+			marker += "_"
+		}
+
+		// Emphasis can't span lines or start or end with spaces
+		lines := strings.Split(segment.text, "\n")
+		for i, line := range lines {
+			if i != 0 {
+				rendered.WriteString("\n")
+			}
+
+			trimmed := strings.TrimSpace(line)
+			if marker == "" || trimmed == "" {
+				rendered.WriteString(line)
+				continue
+			}
+
+			start := strings.Index(line, trimmed)
+			rendered.WriteString(line[:start])
+			rendered.WriteString(marker + trimmed + reverseString(marker))
+			rendered.WriteString(line[start+len(trimmed):])
+		}
+	}
+	return rendered.String()
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// ansiToHTML renders terminal output as an HTML page with its colors.
+func ansiToHTML(text string) string {
+	var rendered strings.Builder
+	rendered.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head>\n")
+	rendered.WriteString("<body style=\"background:#1e1e1e;color:#e5e5e5\"><pre>")
+
+	for _, segment := range parseAnsi(text) {
+		var css []string
+		if segment.style.bold {
+			css = append(css, "font-weight:bold")
+		}
+		if segment.style.italic {
+			css = append(css, "font-style:italic")
+		}
+		if segment.style.underline {
+			css = append(css, "text-decoration:underline")
+		}
+		if segment.style.foreground != "" {
+			css = append(css, "color:"+segment.style.foreground)
+		}
+		if segment.style.background != "" {
+			css = append(css, "background:"+segment.style.background)
+		}
+
+		if len(css) == 0 {
+			rendered.WriteString(html.EscapeString(segment.text))
+		} else {
+			rendered.WriteString("<span style=\"" + strings.Join(css, ";") + "\">" + html.EscapeString(segment.text) + "</span>")
+		}
+	}
+
+	rendered.WriteString("</pre></body></html>\n")
+	return rendered.String()
+}
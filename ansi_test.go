@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAnsi(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		text     string
+		segments []ansiSegment
+	}{
+		{"plain", "plain", []ansiSegment{{"plain", ansiStyle{}}}},
+		{"empty", "", nil},
+		{"bold and reset", "\x1b[1mbold\x1b[0m text", []ansiSegment{{"bold", ansiStyle{bold: true}}, {" text", ansiStyle{}}}},
+		{"empty reset", "\x1b[1ma\x1b[mb", []ansiSegment{{"a", ansiStyle{bold: true}}, {"b", ansiStyle{}}}},
+		{"several codes", "\x1b[1;4;92mx", []ansiSegment{{"x", ansiStyle{bold: true, underline: true, foreground: "#00ff00"}}}},
+		{"default foreground", "\x1b[31mred\x1b[39mplain", []ansiSegment{{"red", ansiStyle{foreground: "#cd0000"}}, {"plain", ansiStyle{}}}},
+		{"256 colors", "\x1b[38;5;196mx", []ansiSegment{{"x", ansiStyle{foreground: "#ff0000"}}}},
+		{"256 grays", "\x1b[48;5;232mx", []ansiSegment{{"x", ansiStyle{background: "#080808"}}}},
+		{"true color", "\x1b[48;2;1;2;3mx", []ansiSegment{{"x", ansiStyle{background: "#010203"}}}},
+		{"other sequences", "\x1b[2K\x1b(Bx\x1b[1A", []ansiSegment{{"x", ansiStyle{}}}},
+		{"window title", "\x1b]0;title\x07text", []ansiSegment{{"text", ansiStyle{}}}},
+		{"hyperlink", "\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\", []ansiSegment{{"link", ansiStyle{}}}},
+		{"unfinished sequence", "x\x1b[31", []ansiSegment{{"x", ansiStyle{}}}},
+		{"crlf", "a\r\nb", []ansiSegment{{"a\nb", ansiStyle{}}}},
+		{"progress", "10%\r50%\r100%\ndone", []ansiSegment{{"100%\ndone", ansiStyle{}}}},
+		{"progress after lines", "one\n\x1b[32mtwo 1\rtwo 2", []ansiSegment{{"one\n", ansiStyle{}}, {"two 2", ansiStyle{foreground: "#00cd00"}}}},
+	} {
+		if segments := parseAnsi(test.text); !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("%v: got %+v, want %+v", test.name, segments, test.segments)
+		}
+	}
+}
+
+func TestAnsiToMarkdown(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		markdown string
+	}{
+		{"plain", "plain"},
+		{"\x1b[1mbold\x1b[0m", "**bold**"},
+		{"\x1b[31m  red \x1b[0m", "  **red** "},
+		{"\x1b[1;3mboth\x1b[0m", "**_both_**"},
+		{"\x1b[4mone\ntwo\x1b[0m", "_one_\n_two_"},
+		{"\x1b[1m\n \x1b[0m", "\n "},
+		{"ok \x1b[32mPASS\x1b[0m done", "ok **PASS** done"},
+	} {
+		if markdown := ansiToMarkdown(test.text); markdown != test.markdown {
+			t.Errorf("%q: got %q, want %q", test.text, markdown, test.markdown)
+		}
+	}
+
+	if stripped := stripAnsi("\x1b[1;31mred\x1b[0m and \x1b[4mplain\x1b[0m"); stripped != "red and plain" {
+		t.Errorf("stripAnsi: got %q", stripped)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/howeyc/gopass"
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	AUTH_LDAP     = "ldap"
+	AUTH_USERNAME = "username"
+	AUTH_ID       = "id"
+	AUTH_TOKEN    = "token"
+
+	// AUTH_EMAIL is another name for AUTH_USERNAME, as the server matches the
+	// login ID against both emails and usernames
+	AUTH_EMAIL = "email"
+)
+
+// getAuthMode returns the auth flag, or when it isn't set picks a mode that
+// the server's client config says is enabled.
+func getAuthMode(cmd *cobra.Command, client *model.Client4) (string, error) {
+	auth, _ := cmd.Flags().GetString("auth")
+	token, _ := cmd.Flags().GetString("token")
+
+	switch auth {
+	case AUTH_EMAIL:
+		return AUTH_USERNAME, nil
+	case AUTH_LDAP, AUTH_USERNAME, AUTH_ID, AUTH_TOKEN:
+		return auth, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Unknown auth mode: %v", auth)
+	}
+
+	if token != "" {
+		return AUTH_TOKEN, nil
+	}
+
+	config, resp := client.GetOldClientConfig("")
+	if resp.Error != nil {
+		// The plain login tries usernames, emails and LDAP, so it is a safe default
+		return AUTH_USERNAME, nil
+	}
+
+	if config["EnableSignInWithEmail"] == "true" || config["EnableSignInWithUsername"] == "true" {
+		return AUTH_USERNAME, nil
+	}
+	if config["EnableLdap"] == "true" {
+		return AUTH_LDAP, nil
+	}
+
+	return AUTH_USERNAME, nil
+}
+
+// loginFields builds the login request for the auth mode, the same way as
+// Client4.Login, Client4.LoginById and Client4.LoginByLdap.
+func loginFields(auth string, loginId string, password string) map[string]string {
+	fields := map[string]string{"password": password}
+
+	switch auth {
+	case AUTH_ID:
+		fields["id"] = loginId
+	case AUTH_LDAP:
+		fields["login_id"] = loginId
+		fields["ldap_only"] = "true"
+	default:
+		fields["login_id"] = loginId
+	}
+
+	return fields
+}
+
+// loginRequest logs in like Client4.Login, but with any of the login fields,
+// which lets it include an MFA token.
+func loginRequest(client *model.Client4, fields map[string]string) (*model.User, *model.Response) {
+	r, err := client.DoApiPost("/users/login", model.MapToJson(fields))
+	if err != nil {
+		return nil, model.BuildErrorResponse(r, err)
+	}
+	defer r.Body.Close()
+
+	client.AuthToken = r.Header.Get(model.HEADER_TOKEN)
+	client.AuthType = model.HEADER_BEARER
+
+	return model.UserFromJson(r.Body), model.BuildResponse(r)
+}
+
+// loginWithToken uses an existing token instead of logging in, prompting for
+// it when it was not given.
+func loginWithToken(cmd *cobra.Command, client *model.Client4) (*model.User, error) {
+	token, _ := cmd.Flags().GetString("token")
+
+	if token == "" {
+		fmt.Print("Token: ")
+		gettoken, err := gopass.GetPasswd()
+		if err != nil {
+			return nil, fmt.Errorf("Need a token")
+		}
+		token = string(gettoken)
+		cmd.Flags().Set("token", token)
+	}
+
+	client.AuthToken = token
+	client.AuthType = model.HEADER_BEARER
+
+	user, resp := client.GetMe("")
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return user, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+func TestGetAuthMode(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		args   []string
+		config map[string]string
+		auth   string
+	}{
+		{"username", []string{"--auth", "username"}, nil, AUTH_USERNAME},
+		{"email is username", []string{"--auth", "email"}, nil, AUTH_USERNAME},
+		{"ldap", []string{"--auth", "ldap"}, nil, AUTH_LDAP},
+		{"token given", []string{"--token", "abc"}, nil, AUTH_TOKEN},
+		{"no config", nil, nil, AUTH_USERNAME},
+		{"email enabled", nil, map[string]string{"EnableSignInWithEmail": "true", "EnableLdap": "true"}, AUTH_USERNAME},
+		{"only ldap", nil, map[string]string{"EnableSignInWithEmail": "false", "EnableSignInWithUsername": "false", "EnableLdap": "true"}, AUTH_LDAP},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.config == nil || r.URL.Path != "/api/v4/config/client" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(model.MapToJson(test.config)))
+		}))
+
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("auth", "", "")
+		cmd.Flags().String("token", "", "")
+		cmd.ParseFlags(test.args)
+
+		auth, err := getAuthMode(cmd, model.NewAPIv4Client(server.URL))
+		server.Close()
+
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		} else if auth != test.auth {
+			t.Errorf("%v: got %v, want %v", test.name, auth, test.auth)
+		}
+	}
+
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("auth", "saml", "")
+	if _, err := getAuthMode(cmd, model.NewAPIv4Client("http://127.0.0.1:1")); err == nil {
+		t.Error("unknown mode: got no error")
+	}
+}
+
+func TestLoginFields(t *testing.T) {
+	for _, test := range []struct {
+		auth   string
+		fields map[string]string
+	}{
+		{AUTH_USERNAME, map[string]string{"login_id": "alice", "password": "pw"}},
+		{AUTH_LDAP, map[string]string{"login_id": "alice", "password": "pw", "ldap_only": "true"}},
+		{AUTH_ID, map[string]string{"id": "alice", "password": "pw"}},
+	} {
+		if fields := loginFields(test.auth, "alice", "pw"); !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%v: got %v, want %v", test.auth, fields, test.fields)
+		}
+	}
+}
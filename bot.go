@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var botCmd = &cobra.Command{
+	Use:   "bot [server]",
+	Short: "Run commands for messages that match rules, and reply with the output",
+	Long: `Run commands for messages that match rules, and reply with the output.
+
+The bot watches every channel the user is in over a WebSocket, including direct
+messages and threads. Messages that match a rule run its command, and the
+output is posted when the command finishes, as a reply in the message's thread
+or as a file.
+
+Every rule names the users who may run it, or users = ["*"] for anyone. The
+words of the message, or the groups of a pattern, are passed to the command as
+its arguments, so commands must treat them as untrusted input.`,
+	RunE: doBotCmdF,
+}
+
+func init() {
+	botCmd.Flags().String("rules", "", "TOML file of the messages to match and the commands they run")
+	botCmd.Flags().Int("max-concurrent", 4, "The most commands to run at once, others wait their turn")
+	botCmd.Flags().Duration("script-timeout", time.Minute, "Time limit for commands whose rules don't set their own")
+	botCmd.Flags().Int("max-output", 3000, "The most output in bytes to reply with in a message, more is uploaded as a file")
+	botCmd.Flags().Int("max-file-size", 10*1024*1024, "The most output in bytes to upload as a file")
+
+	rootCmd.AddCommand(botCmd)
+}
+
+const (
+	BOT_OUTPUT_REPLY = "reply"
+	BOT_OUTPUT_FILE  = "file"
+)
+
+// botRules lists what the bot responds to, like:
+//
+//	[[rule]]
+//	command = "!deploy"
+//	run = ["scripts/deploy.sh"]
+//	users = ["alice", "bob"]
+//	channels = ["ops"]
+//	timeout = "10m"
+//
+//	[[rule]]
+//	pattern = "^status of (\\w+)$"
+//	run = ["scripts/status.sh"]
+//	users = ["*"]
+//	output = "file"
+type botRules struct {
+	Rules []*botRule `toml:"rule"`
+}
+
+type botRule struct {
+	Command  string   `toml:"command"`
+	Pattern  string   `toml:"pattern"`
+	Run      []string `toml:"run"`
+	Users    []string `toml:"users"`
+	Channels []string `toml:"channels"`
+	Timeout  string   `toml:"timeout"`
+	Output   string   `toml:"output"`
+	Markdown bool     `toml:"markdown"`
+
+	pattern *regexp.Regexp
+	timeout time.Duration
+	userIds map[string]bool
+	anyone  bool
+}
+
+// match returns the arguments to run the rule's command with, which are the
+// words after a command or the groups of a pattern. They come from whoever
+// sent the message.
+func (rule *botRule) match(message string) ([]string, bool) {
+	if rule.pattern != nil {
+		match := rule.pattern.FindStringSubmatch(message)
+		if match == nil {
+			return nil, false
+		}
+		return match[1:], true
+	}
+
+	fields := strings.Fields(message)
+	if len(fields) == 0 || fields[0] != rule.Command {
+		return nil, false
+	}
+	return fields[1:], true
+}
+
+// allows reports whether the user may run the rule's command in the channel.
+// Channels are given by ID or name.
+func (rule *botRule) allows(userId string, channelId string, channelName string) bool {
+	if !rule.anyone && !rule.userIds[userId] {
+		return false
+	}
+
+	if len(rule.Channels) == 0 {
+		return true
+	}
+	for _, channel := range rule.Channels {
+		if channel == channelId || channel == channelName {
+			return true
+		}
+	}
+	return false
+}
+
+// bot runs the commands for the messages it sees.
+type bot struct {
+	cmd         *cobra.Command
+	session     *serveSession
+	user        *model.User
+	rules       []*botRule
+	slots       chan struct{}
+	maxOutput   int
+	maxFileSize int
+}
+
+func doBotCmdF(cmd *cobra.Command, args []string) error {
+	rulesFile, _ := cmd.Flags().GetString("rules")
+	maxConcurrent, _ := cmd.Flags().GetInt("max-concurrent")
+	scriptTimeout, _ := cmd.Flags().GetDuration("script-timeout")
+	maxOutput, _ := cmd.Flags().GetInt("max-output")
+	maxFileSize, _ := cmd.Flags().GetInt("max-file-size")
+
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	if rulesFile == "" {
+		return fmt.Errorf("Need a rules file")
+	}
+
+	if maxConcurrent < 1 {
+		return fmt.Errorf("Need a --max-concurrent of at least 1")
+	}
+
+	data, err := ioutil.ReadFile(rulesFile)
+	if err != nil {
+		return err
+	}
+
+	var parsed botRules
+	if err := toml.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("Unable to read rules %v: %v", rulesFile, err.Error())
+	}
+
+	for i, rule := range parsed.Rules {
+		if (rule.Command == "") == (rule.Pattern == "") {
+			return fmt.Errorf("Rule %v in %v needs either a command or a pattern", i+1, rulesFile)
+		}
+		if len(rule.Run) == 0 {
+			return fmt.Errorf("Rule %v in %v has nothing to run", i+1, rulesFile)
+		}
+		if len(rule.Users) == 0 {
+			return fmt.Errorf("Rule %v in %v needs users, or users = [\"*\"] to let anyone run it", i+1, rulesFile)
+		}
+
+		if rule.Pattern != "" {
+			if rule.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("Invalid pattern in rule %v: %v", i+1, err.Error())
+			}
+		}
+
+		switch rule.Output {
+		case "":
+			rule.Output = BOT_OUTPUT_REPLY
+		case BOT_OUTPUT_REPLY, BOT_OUTPUT_FILE:
+		default:
+			return fmt.Errorf("Rule %v in %v has an invalid output, use reply or file", i+1, rulesFile)
+		}
+
+		rule.timeout = scriptTimeout
+		if rule.Timeout != "" {
+			if rule.timeout, err = time.ParseDuration(rule.Timeout); err != nil {
+				return fmt.Errorf("Invalid timeout in rule %v: %v", i+1, err.Error())
+			}
+		}
+	}
+
+	session, err := newServeSession(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	// Posts only have user IDs, so look up the allowed users once
+	for i, rule := range parsed.Rules {
+		rule.userIds = map[string]bool{}
+		for _, username := range rule.Users {
+			if username == "*" {
+				rule.anyone = true
+				fmt.Printf("Rule %v lets anyone run %v, including from direct messages\n", i+1, rule.Run[0])
+				continue
+			}
+
+			username = strings.TrimPrefix(username, "@")
+			err := session.do(func(client *model.Client4, user *model.User) error {
+				found, resp := client.GetUserByUsername(username, "")
+				if resp.Error != nil {
+					return resp.Error
+				}
+				rule.userIds[found.Id] = true
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("Unable to find user %v: %v", username, err.Error())
+			}
+		}
+	}
+
+	b := &bot{
+		cmd:         cmd,
+		session:     session,
+		user:        session.user,
+		rules:       parsed.Rules,
+		slots:       make(chan struct{}, maxConcurrent),
+		maxOutput:   maxOutput,
+		maxFileSize: maxFileSize,
+	}
+
+	return b.run()
+}
+
+// run listens for messages until the program is stopped, reconnecting with
+// backoff when the connection drops.
+func (b *bot) run() error {
+	wait := time.Second
+	for {
+		conn, err := b.connect()
+		if err != nil {
+			fmt.Println("Unable to connect, retrying in " + wait.String())
+			fmt.Println(" Error: " + err.Error())
+			time.Sleep(wait)
+			if wait *= 2; wait > time.Minute {
+				wait = time.Minute
+			}
+			continue
+		}
+		wait = time.Second
+
+		fmt.Println("Listening for messages as " + b.user.Username)
+		err = b.listen(conn)
+		conn.Close()
+
+		fmt.Println("Connection lost, reconnecting")
+		fmt.Println(" Error: " + err.Error())
+		time.Sleep(wait)
+	}
+}
+
+// connect opens the WebSocket, first checking the session so an expired one
+// is replaced before it's used to authenticate.
+func (b *bot) connect() (*websocket.Conn, error) {
+	var conn *websocket.Conn
+	err := b.session.do(func(client *model.Client4, user *model.User) error {
+		if _, resp := client.GetMe(""); resp.Error != nil {
+			return resp.Error
+		}
+
+		var err error
+		conn, err = dialWebSocket(b.cmd, client)
+		return err
+	})
+	return conn, err
+}
+
+const (
+	// botPongWait is how long the connection can be silent before it counts
+	// as dead, as connections can drop without being closed
+	botPongWait = time.Minute
+
+	// botPingPeriod is how often to ping the server, which answers with a pong
+	botPingPeriod = botPongWait * 9 / 10
+)
+
+// listen handles the events from the connection until it fails or goes
+// silent.
+func (b *bot) listen(conn *websocket.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(botPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(botPongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(botPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					// The read fails too once the connection is gone
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(botPongWait))
+
+		event := model.WebSocketEventFromJson(bytes.NewReader(data))
+		if event == nil || event.Event != model.WEBSOCKET_EVENT_POSTED {
+			continue
+		}
+
+		postJson, _ := event.Data["post"].(string)
+		post := model.PostFromJson(strings.NewReader(postJson))
+		if post == nil {
+			continue
+		}
+
+		b.handlePost(post, event)
+	}
+}
+
+// handlePost starts the command of the first rule that matches the post and
+// allows its author. Webhook posts are ignored so bots can't set each other
+// off.
+func (b *bot) handlePost(post *model.Post, event *model.WebSocketEvent) {
+	if post.UserId == b.user.Id || post.Type != model.POST_DEFAULT || post.Props["from_webhook"] == "true" {
+		return
+	}
+
+	channelName, _ := event.Data["channel_name"].(string)
+	senderName, _ := event.Data["sender_name"].(string)
+	senderName = strings.TrimPrefix(senderName, "@")
+
+	for _, rule := range b.rules {
+		args, ok := rule.match(post.Message)
+		if !ok {
+			continue
+		}
+
+		if !rule.allows(post.UserId, post.ChannelId, channelName) {
+			fmt.Println("Ignoring message from " + senderName + ", who isn't allowed to run " + rule.Run[0] + " here")
+			continue
+		}
+
+		teamId, _ := event.Data["team_id"].(string)
+		if teamId == "" {
+			teamId = event.Broadcast.TeamId
+		}
+
+		env := []string{
+			"MM_TEXT=" + post.Message,
+			"MM_USER_ID=" + post.UserId,
+			"MM_USER_NAME=" + senderName,
+			"MM_CHANNEL_ID=" + post.ChannelId,
+			"MM_CHANNEL_NAME=" + channelName,
+			"MM_TEAM_ID=" + teamId,
+			"MM_POST_ID=" + post.Id,
+			"MM_ROOT_ID=" + post.RootId,
+		}
+		go b.runRule(rule, args, env, post)
+		return
+	}
+}
+
+// runRule runs the rule's command once a slot is free and replies in the
+// post's thread with the output.
+func (b *bot) runRule(rule *botRule, args []string, env []string, post *model.Post) {
+	b.slots <- struct{}{}
+	output, err := runScript(append(append([]string{}, rule.Run...), args...), post.Message, env, rule.timeout, b.maxFileSize)
+	<-b.slots
+
+	if err != nil {
+		fmt.Println("Command " + rule.Run[0] + " failed")
+		fmt.Println(" Error: " + err.Error())
+	}
+
+	reply := &model.Post{
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Type:      model.POST_DEFAULT,
+	}
+	if reply.RootId == "" {
+		reply.RootId = post.Id
+	}
+
+	var attachments []string
+	if rule.Output == BOT_OUTPUT_FILE || len(output) > b.maxOutput {
+		dir, dirErr := ioutil.TempDir("", "mattermost-poster-bot")
+		if dirErr != nil {
+			fmt.Println("Unable to save output of " + rule.Run[0])
+			fmt.Println(" Error: " + dirErr.Error())
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, filepath.Base(rule.Run[0])+".txt")
+		if writeErr := ioutil.WriteFile(filename, []byte(stripAnsi(output)), 0600); writeErr != nil {
+			fmt.Println("Unable to save output of " + rule.Run[0])
+			fmt.Println(" Error: " + writeErr.Error())
+			return
+		}
+		attachments = append(attachments, filename)
+
+		reply.Message = scriptReply("", err, false)
+	} else {
+		reply.Message = scriptReply(output, err, rule.Markdown)
+	}
+
+	if reply.Message == "" && len(attachments) == 0 {
+		reply.Message = "Finished with no output"
+	}
+
+	if _, err := b.session.createPost(reply, attachments); err != nil {
+		fmt.Println("Unable to reply to post " + post.Id)
+		fmt.Println(" Error: " + err.Error())
+	}
+}
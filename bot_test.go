@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestBotRuleMatch(t *testing.T) {
+	command := &botRule{Command: "!deploy"}
+	pattern := &botRule{pattern: regexp.MustCompile(`^status of (\w+)$`)}
+
+	for _, test := range []struct {
+		rule    *botRule
+		message string
+		args    []string
+		ok      bool
+	}{
+		{command, "!deploy api  prod", []string{"api", "prod"}, true},
+		{command, "!deploy", []string{}, true},
+		{command, "!deployed api", nil, false},
+		{command, "please !deploy api", nil, false},
+		{command, "", nil, false},
+		{pattern, "status of api", []string{"api"}, true},
+		{pattern, "status of api; rm -rf /", nil, false},
+	} {
+		args, ok := test.rule.match(test.message)
+		if ok != test.ok || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: got %q %v, want %q %v", test.message, args, ok, test.args, test.ok)
+		}
+	}
+}
+
+func TestBotRuleAllows(t *testing.T) {
+	listed := &botRule{userIds: map[string]bool{"alice": true}, Channels: []string{"ops", "c1"}}
+	anyone := &botRule{userIds: map[string]bool{}, anyone: true}
+	nobody := &botRule{userIds: map[string]bool{}}
+
+	for _, test := range []struct {
+		name        string
+		rule        *botRule
+		userId      string
+		channelId   string
+		channelName string
+		allowed     bool
+	}{
+		{"listed user by channel name", listed, "alice", "c0", "ops", true},
+		{"listed user by channel ID", listed, "alice", "c1", "dev", true},
+		{"listed user elsewhere", listed, "alice", "c0", "town-square", false},
+		{"other user", listed, "mallory", "c0", "ops", false},
+		{"anyone", anyone, "mallory", "c0", "town-square", true},
+		{"no users", nobody, "mallory", "c0", "town-square", false},
+	} {
+		if allowed := test.rule.allows(test.userId, test.channelId, test.channelName); allowed != test.allowed {
+			t.Errorf("%v: got %v, want %v", test.name, allowed, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+)
+
+// ciInfo describes the CI run the poster is running in.
+type ciInfo struct {
+	Provider string
+	Pipeline string
+	Job      string
+	Branch   string
+	Commit   string
+	User     string
+	RunUrl   string
+}
+
+// ciStatusColors are the card colors for the statuses CI systems report.
+var ciStatusColors = map[string]string{
+	"success":   "#2eb886",
+	"passed":    "#2eb886",
+	"fixed":     "#2eb886",
+	"failure":   "#a30200",
+	"failed":    "#a30200",
+	"error":     "#a30200",
+	"broken":    "#a30200",
+	"unstable":  "#daa038",
+	"running":   "#daa038",
+	"pending":   "#daa038",
+	"started":   "#daa038",
+	"cancelled": "#808080",
+	"canceled":  "#808080",
+	"skipped":   "#808080",
+	"aborted":   "#808080",
+}
+
+// firstEnv returns the first of the environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// detectCI reads the run details from the environment variables GitHub
+// Actions, GitLab CI, Jenkins, Drone and Buildkite set, or returns nil when
+// not running in any of them.
+func detectCI() *ciInfo {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		info := &ciInfo{
+			Provider: "GitHub Actions",
+			Pipeline: os.Getenv("GITHUB_WORKFLOW"),
+			Job:      os.Getenv("GITHUB_JOB"),
+			Branch:   firstEnv("GITHUB_HEAD_REF", "GITHUB_REF_NAME"),
+			Commit:   os.Getenv("GITHUB_SHA"),
+			User:     os.Getenv("GITHUB_ACTOR"),
+		}
+		if info.Branch == "" {
+			info.Branch = strings.TrimPrefix(os.Getenv("GITHUB_REF"), "refs/heads/")
+		}
+		if repo, runId := os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"); repo != "" && runId != "" {
+			server := firstEnv("GITHUB_SERVER_URL")
+			if server == "" {
+				server = "https://github.com"
+			}
+			info.RunUrl = server + "/" + repo + "/actions/runs/" + runId
+		}
+		return info
+	case os.Getenv("GITLAB_CI") == "true":
+		info := &ciInfo{
+			Provider: "GitLab CI",
+			Pipeline: os.Getenv("CI_PROJECT_PATH"),
+			Job:      os.Getenv("CI_JOB_NAME"),
+			Branch:   firstEnv("CI_COMMIT_REF_NAME", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"),
+			Commit:   os.Getenv("CI_COMMIT_SHA"),
+			User:     firstEnv("GITLAB_USER_LOGIN", "GITLAB_USER_NAME"),
+			RunUrl:   firstEnv("CI_PIPELINE_URL", "CI_JOB_URL"),
+		}
+		if pipelineId := os.Getenv("CI_PIPELINE_ID"); pipelineId != "" {
+			info.Pipeline += " #" + pipelineId
+		}
+		return info
+	case os.Getenv("JENKINS_URL") != "":
+		info := &ciInfo{
+			Provider: "Jenkins",
+			Pipeline: os.Getenv("JOB_NAME"),
+			Job:      os.Getenv("STAGE_NAME"),
+			Branch:   strings.TrimPrefix(firstEnv("BRANCH_NAME", "GIT_BRANCH"), "origin/"),
+			Commit:   os.Getenv("GIT_COMMIT"),
+			User:     firstEnv("BUILD_USER_ID", "CHANGE_AUTHOR"),
+			RunUrl:   os.Getenv("BUILD_URL"),
+		}
+		if build := os.Getenv("BUILD_NUMBER"); build != "" {
+			info.Pipeline += " #" + build
+		}
+		return info
+	case os.Getenv("DRONE") == "true":
+		info := &ciInfo{
+			Provider: "Drone",
+			Pipeline: os.Getenv("DRONE_REPO"),
+			Job:      firstEnv("DRONE_STAGE_NAME", "DRONE_STEP_NAME"),
+			Branch:   firstEnv("DRONE_SOURCE_BRANCH", "DRONE_BRANCH"),
+			Commit:   firstEnv("DRONE_COMMIT_SHA", "DRONE_COMMIT"),
+			User:     firstEnv("DRONE_COMMIT_AUTHOR", "DRONE_BUILD_TRIGGER"),
+			RunUrl:   os.Getenv("DRONE_BUILD_LINK"),
+		}
+		if build := os.Getenv("DRONE_BUILD_NUMBER"); build != "" {
+			info.Pipeline += " #" + build
+		}
+		return info
+	case os.Getenv("BUILDKITE") == "true":
+		info := &ciInfo{
+			Provider: "Buildkite",
+			Pipeline: os.Getenv("BUILDKITE_PIPELINE_SLUG"),
+			Job:      os.Getenv("BUILDKITE_LABEL"),
+			Branch:   os.Getenv("BUILDKITE_BRANCH"),
+			Commit:   os.Getenv("BUILDKITE_COMMIT"),
+			User:     firstEnv("BUILDKITE_BUILD_CREATOR", "BUILDKITE_BUILD_AUTHOR"),
+			RunUrl:   os.Getenv("BUILDKITE_BUILD_URL"),
+		}
+		if build := os.Getenv("BUILDKITE_BUILD_NUMBER"); build != "" {
+			info.Pipeline += " #" + build
+		}
+		return info
+	}
+
+	return nil
+}
+
+// ciCard builds an attachment describing the CI run, colored by its status.
+func ciCard(info *ciInfo, status string) (*model.SlackAttachment, error) {
+	color := ""
+	if status != "" {
+		var ok bool
+		if color, ok = ciStatusColors[strings.ToLower(status)]; !ok {
+			return nil, fmt.Errorf("Unknown --status: %v", status)
+		}
+	}
+
+	commit := info.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+
+	var fields []*model.SlackAttachmentField
+	addField := func(title string, value string) {
+		if value != "" {
+			fields = append(fields, &model.SlackAttachmentField{Title: title, Value: value, Short: true})
+		}
+	}
+	addField("Status", status)
+	addField("Job", info.Job)
+	addField("Branch", info.Branch)
+	addField("Commit", commit)
+	addField("Triggered by", info.User)
+
+	fallback := info.Provider + " " + info.Pipeline
+	if status != "" {
+		fallback += ": " + status
+	}
+
+	return &model.SlackAttachment{
+		Fallback:   fallback,
+		Color:      color,
+		AuthorName: info.Provider,
+		Title:      info.Pipeline,
+		TitleLink:  info.RunUrl,
+		Fields:     fields,
+	}, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+// codeLanguages maps file extensions to the code block languages Mattermost
+// highlights.
+var codeLanguages = map[string]string{
+	".bash":  "bash",
+	".c":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cs":    "cs",
+	".css":   "css",
+	".diff":  "diff",
+	".go":    "go",
+	".h":     "c",
+	".hpp":   "cpp",
+	".html":  "html",
+	".ini":   "ini",
+	".java":  "java",
+	".js":    "javascript",
+	".json":  "json",
+	".jsx":   "javascript",
+	".kt":    "kotlin",
+	".lua":   "lua",
+	".m":     "objectivec",
+	".md":    "markdown",
+	".patch": "diff",
+	".php":   "php",
+	".pl":    "perl",
+	".ps1":   "powershell",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scala": "scala",
+	".sh":    "bash",
+	".sql":   "sql",
+	".swift": "swift",
+	".tex":   "latex",
+	".toml":  "ini",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zsh":   "bash",
+}
+
+// shebangLanguages maps interpreters named in a shebang line to code block
+// languages.
+var shebangLanguages = map[string]string{
+	"bash":    "bash",
+	"node":    "javascript",
+	"perl":    "perl",
+	"php":     "php",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"ruby":    "ruby",
+	"sh":      "bash",
+	"zsh":     "bash",
+}
+
+// detectCodeLanguage picks the code block language from the file extension,
+// or from the shebang line when the extension doesn't say.
+func detectCodeLanguage(filename string, content string) string {
+	if language, ok := codeLanguages[strings.ToLower(filepath.Ext(filename))]; ok {
+		return language
+	}
+
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+
+	line := content[2:]
+	if end := strings.Index(line, "\n"); end != -1 {
+		line = line[:end]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env's own options, like -S
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	return shebangLanguages[interpreter]
+}
+
+// codeFence returns a fence longer than any run of backticks in the content,
+// so the content can't close the code block early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// codeBlock wraps the content in a fenced code block.
+func codeBlock(content string, language string) string {
+	fence := codeFence(content)
+	return fence + language + "\n" + strings.TrimRight(content, "\n") + "\n" + fence
+}
+
+// renderCodeMessage reads the code flag and puts the file in a code block
+// after the message, returning any files to attach with it. When the file is
+// over the size threshold, or too big to fit in a post, the message is left
+// as it is and the file is attached instead. Escape codes are removed with
+// --ansi, and with --ansi render a colored HTML copy is attached too, as
+// code blocks can't show colors.
+func renderCodeMessage(cmd *cobra.Command, message string) (string, []string, error) {
+	filename, _ := cmd.Flags().GetString("code")
+	language, _ := cmd.Flags().GetString("code-lang")
+	maxSize, _ := cmd.Flags().GetInt("code-max-size")
+	ansi, _ := cmd.Flags().GetString("ansi")
+
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	content := string(data)
+
+	var attachments []string
+	if ansi == ANSI_RENDER {
+		rendered, err := tempAttachment("output.html", []byte(ansiToHTML(content)))
+		if err != nil {
+			return "", nil, err
+		}
+		attachments = append(attachments, rendered)
+	}
+	if ansi != "" {
+		content = stripAnsi(content)
+	}
+
+	if language == "" {
+		language = detectCodeLanguage(filename, content)
+	}
+
+	block := codeBlock(content, language)
+	withBlock := block
+	if message != "" {
+		withBlock = message + "\n\n" + block
+	}
+
+	if utf8.RuneCountInString(content) <= maxSize && utf8.RuneCountInString(withBlock) <= model.POST_MESSAGE_MAX_RUNES {
+		return withBlock, attachments, nil
+	}
+
+	fmt.Println("Code is too big to post inline, attaching it instead")
+
+	// Attach the file as it was read unless it came from stdin or had its
+	// escape codes removed
+	if filename != "-" && ansi == "" {
+		return message, append(attachments, filename), nil
+	}
+
+	name := "snippet.txt"
+	if filename != "-" {
+		name = filepath.Base(filename)
+	}
+	attachment, err := tempAttachment(name, []byte(content))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return message, append(attachments, attachment), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestDetectCodeLanguage(t *testing.T) {
+	for _, test := range []struct {
+		filename string
+		content  string
+		language string
+	}{
+		{"main.go", "package main\n", "go"},
+		{"Script.PY", "", "python"},
+		{"run", "#!/bin/sh\necho hi\n", "bash"},
+		{"run", "#!/usr/bin/env python3\n", "python"},
+		{"run", "#!/usr/bin/env -S node --harmony\n", "javascript"},
+		{"run.sh", "#!/usr/bin/env python3\n", "bash"},
+		{"run", "#!/usr/bin/env\n", ""},
+		{"run", "#!\n", ""},
+		{"run", "#!/usr/bin/awk -f\n", ""},
+		{"notes", "plain text\n", ""},
+	} {
+		if language := detectCodeLanguage(test.filename, test.content); language != test.language {
+			t.Errorf("%v %q: got %q, want %q", test.filename, test.content, language, test.language)
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		fence   string
+	}{
+		{"", "```"},
+		{"no backticks", "```"},
+		{"`inline` and ``two``", "```"},
+		{"```go\nfmt.Println()\n```", "````"},
+		{"`````", "``````"},
+		{"``` then ````", "`````"},
+	} {
+		if fence := codeFence(test.content); fence != test.fence {
+			t.Errorf("%q: got %q, want %q", test.content, fence, test.fence)
+		}
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		language string
+		block    string
+	}{
+		{"x := 1\n\n", "go", "```go\nx := 1\n```"},
+		{"plain", "", "```\nplain\n```"},
+		{"```\nnested\n```\n", "markdown", "````markdown\n```\nnested\n```\n````"},
+	} {
+		if block := codeBlock(test.content, test.language); block != test.block {
+			t.Errorf("%q %v: got %q, want %q", test.content, test.language, block, test.block)
+		}
+	}
+}
+
+func TestRenderCodeMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "code-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "build.sh")
+	if err := ioutil.WriteFile(filename, []byte("#!/bin/sh\nmake\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		args        []string
+		message     string
+		rendered    string
+		attachments []string
+	}{
+		{"inline", nil, "Build script", "Build script\n\n```bash\n#!/bin/sh\nmake\n```", nil},
+		{"no message", []string{"--code-lang", "sh"}, "", "```sh\n#!/bin/sh\nmake\n```", nil},
+		{"too big", []string{"--code-max-size", "5"}, "Build script", "Build script", []string{filename}},
+	} {
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("code", "", "")
+		cmd.Flags().String("code-lang", "", "")
+		cmd.Flags().Int("code-max-size", 3000, "")
+		cmd.Flags().String("ansi", "", "")
+		if err := cmd.ParseFlags(append([]string{"--code", filename}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+
+		rendered, attachments, err := renderCodeMessage(cmd, test.message)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if rendered != test.rendered || !reflect.DeepEqual(attachments, test.attachments) {
+			t.Errorf("%v: got %q %v, want %q %v", test.name, rendered, attachments, test.rendered, test.attachments)
+		}
+	}
+
+	// Stripped code is attached from a copy, under the original name
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("code", filename, "")
+	cmd.Flags().String("code-lang", "", "")
+	cmd.Flags().Int("code-max-size", 5, "")
+	cmd.Flags().String("ansi", ANSI_STRIP, "")
+	_, attachments, err := renderCodeMessage(cmd, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 || attachments[0] == filename || filepath.Base(attachments[0]) != "build.sh" {
+		t.Errorf("got %v, want a copy of build.sh", attachments)
+	} else if data, _ := ioutil.ReadFile(attachments[0]); !strings.Contains(string(data), "make") {
+		t.Errorf("got %q in the copy", data)
+	}
+}
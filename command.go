@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var commandCmd = &cobra.Command{
+	Use:   "command [server] [slash command]",
+	Short: "Execute a slash command in a channel",
+	RunE:  doCommandCmdF,
+}
+
+func init() {
+	commandCmd.Flags().BoolP("list", "l", false, "List the slash commands available for autocomplete")
+
+	rootCmd.AddCommand(commandCmd)
+}
+
+func doCommandCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	list, _ := cmd.Flags().GetBool("list")
+
+	if !list && len(args) < 2 {
+		return fmt.Errorf("Need a slash command")
+	}
+
+	client, _, err := login(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	channel, err := getChannel(cmd, client)
+	if err != nil {
+		return err
+	}
+
+	if list {
+		commands, resp := client.ListAutocompleteCommands(channel.TeamId)
+		if resp.Error != nil {
+			return resp.Error
+		}
+		for _, command := range commands {
+			fmt.Println("/" + command.Trigger + " " + command.AutoCompleteHint + " - " + command.AutoCompleteDesc)
+		}
+		return nil
+	}
+
+	command := strings.Join(args[1:], " ")
+	if !strings.HasPrefix(command, "/") {
+		command = "/" + command
+	}
+
+	commandResp, resp := client.ExecuteCommand(channel.Id, command)
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	printCommandResponse(commandResp)
+
+	return nil
+}
+
+func printCommandResponse(commandResp *model.CommandResponse) {
+	if commandResp.ResponseType != "" {
+		fmt.Println("Response type: " + commandResp.ResponseType)
+	}
+	if commandResp.GotoLocation != "" {
+		fmt.Println("Goto location: " + commandResp.GotoLocation)
+	}
+	if commandResp.Text != "" {
+		fmt.Println(commandResp.Text)
+	}
+	printAttachments(commandResp.Attachments)
+}
+
+func printAttachments(attachments []*model.SlackAttachment) {
+	for _, attachment := range attachments {
+		fmt.Println("---")
+		if attachment.Pretext != "" {
+			fmt.Println(attachment.Pretext)
+		}
+		if attachment.AuthorName != "" {
+			fmt.Println("Author: " + attachment.AuthorName)
+		}
+		if attachment.Title != "" {
+			fmt.Println(attachment.Title)
+		}
+		if attachment.TitleLink != "" {
+			fmt.Println(attachment.TitleLink)
+		}
+		if attachment.Text != "" {
+			fmt.Println(attachment.Text)
+		}
+		for _, field := range attachment.Fields {
+			fmt.Printf("%v: %v\n", field.Title, field.Value)
+		}
+		if attachment.Footer != "" {
+			fmt.Println(attachment.Footer)
+		}
+	}
+}
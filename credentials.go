@@ -0,0 +1,481 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/howeyc/gopass"
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login [server]",
+	Short: "Login and save the session token so later commands don't need a password",
+	RunE:  doLoginCmdF,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout [server]",
+	Short: "Revoke the saved session and remove it",
+	RunE:  doLogoutCmdF,
+}
+
+func init() {
+	loginCmd.Flags().String("store", "", "Where to save the token: keyring or file (default keyring when available)")
+
+	rootCmd.AddCommand(loginCmd, logoutCmd)
+}
+
+// credentialStore saves session tokens by server and username. An empty
+// username matches the first token saved for the server.
+type credentialStore interface {
+	get(server string, username string) (string, string, error)
+	set(server string, username string, token string) error
+	remove(server string, username string) error
+}
+
+// getCredentialStores returns the stores to look for saved tokens in, in
+// order of preference. The encrypted file is only used once it exists, so
+// looking for a token never prompts for its passphrase needlessly.
+func getCredentialStores() []credentialStore {
+	var stores []credentialStore
+	if hasSecretTool() {
+		stores = append(stores, &keyringStore{})
+	}
+	if _, err := os.Stat(credentialsFile()); err == nil {
+		stores = append(stores, &fileStore{filename: credentialsFile()})
+	}
+	return stores
+}
+
+func doLoginCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	storeName, _ := cmd.Flags().GetString("store")
+
+	var store credentialStore
+	switch storeName {
+	case "keyring":
+		if !hasSecretTool() {
+			return fmt.Errorf("No keyring available, secret-tool was not found")
+		}
+		store = &keyringStore{}
+	case "file":
+		store = &fileStore{filename: credentialsFile()}
+	case "":
+		if hasSecretTool() {
+			store = &keyringStore{}
+		} else {
+			store = &fileStore{filename: credentialsFile()}
+		}
+	default:
+		return fmt.Errorf("Unknown store: %v", storeName)
+	}
+
+	client, err := newClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	// Always make a new session rather than reusing a saved one
+	user, err := createSession(cmd, client)
+	if err != nil {
+		return err
+	}
+
+	err = store.set(args[0], user.Username, client.AuthToken)
+	if _, isKeyring := store.(*keyringStore); err != nil && isKeyring && storeName == "" {
+		// The keyring tool may be installed on a machine with no keyring running
+		fmt.Println("Unable to use the keyring, saving to " + credentialsFile() + " instead")
+		fmt.Println(" Error: " + err.Error())
+
+		store = &fileStore{filename: credentialsFile()}
+		err = store.set(args[0], user.Username, client.AuthToken)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Logged in as " + user.Username)
+	return nil
+}
+
+func doLogoutCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	username, _ := cmd.Flags().GetString("username")
+
+	found := false
+	for _, store := range getCredentialStores() {
+		savedUsername, token, err := store.get(args[0], username)
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			continue
+		}
+		found = true
+
+		client, err := newClient(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		client.AuthToken = token
+		client.AuthType = model.HEADER_BEARER
+
+		if _, resp := client.Logout(); resp.Error != nil && resp.StatusCode != 401 {
+			fmt.Println("Unable to revoke session, removing it anyway")
+			fmt.Println(" Error: " + resp.Error.Error())
+		}
+
+		if err := store.remove(args[0], savedUsername); err != nil {
+			return err
+		}
+
+		fmt.Println("Logged out " + savedUsername)
+	}
+
+	if !found {
+		return fmt.Errorf("No saved login for %v", args[0])
+	}
+
+	return nil
+}
+
+// loginWithSavedToken uses a token saved by the login subcommand, returning
+// a nil user when there is none or it no longer works.
+func loginWithSavedToken(client *model.Client4, server string, username string) *model.User {
+	for _, store := range getCredentialStores() {
+		_, token, err := store.get(server, username)
+		if err != nil {
+			fmt.Println("Unable to read saved login")
+			fmt.Println(" Error: " + err.Error())
+			continue
+		}
+		if token == "" {
+			continue
+		}
+
+		client.AuthToken = token
+		client.AuthType = model.HEADER_BEARER
+
+		if user, resp := client.GetMe(""); resp.Error == nil {
+			return user
+		}
+
+		client.AuthToken = ""
+	}
+
+	return nil
+}
+
+// keyringStore saves tokens in the Secret Service keyring through the
+// secret-tool command from libsecret.
+type keyringStore struct{}
+
+func hasSecretTool() bool {
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func keyringAttributes(server string, username string) []string {
+	attributes := []string{"service", "mattermost-poster", "server", server}
+	if username != "" {
+		attributes = append(attributes, "username", username)
+	}
+	return attributes
+}
+
+func (s *keyringStore) get(server string, username string) (string, string, error) {
+	out, err := exec.Command("secret-tool", append([]string{"search"}, keyringAttributes(server, username)...)...).CombinedOutput()
+	if err != nil {
+		// secret-tool exits with an error when nothing matches
+		return "", "", nil
+	}
+
+	var foundUsername, token string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "attribute.username = ") && foundUsername == "" {
+			foundUsername = strings.TrimPrefix(line, "attribute.username = ")
+		} else if strings.HasPrefix(line, "secret = ") && token == "" {
+			token = strings.TrimPrefix(line, "secret = ")
+		}
+	}
+
+	return foundUsername, token, nil
+}
+
+func (s *keyringStore) set(server string, username string, token string) error {
+	args := append([]string{"store", "--label=Mattermost " + username + " on " + server}, keyringAttributes(server, username)...)
+	store := exec.Command("secret-tool", args...)
+	store.Stdin = strings.NewReader(token)
+	if out, err := store.CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to save to keyring: %v %v", err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *keyringStore) remove(server string, username string) error {
+	if out, err := exec.Command("secret-tool", append([]string{"clear"}, keyringAttributes(server, username)...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to remove from keyring: %v %v", err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// fileStore saves tokens in a file encrypted with a key derived from a
+// passphrase, for machines without a keyring. The passphrase is read from
+// MATTERMOST_POSTER_PASSPHRASE or prompted for.
+type fileStore struct {
+	filename   string
+	passphrase []byte
+}
+
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+type savedToken struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+func credentialsFile() string {
+	return filepath.Join(configDir(), "credentials")
+}
+
+func (s *fileStore) getPassphrase() ([]byte, error) {
+	if s.passphrase != nil {
+		return s.passphrase, nil
+	}
+
+	if passphrase := os.Getenv("MATTERMOST_POSTER_PASSPHRASE"); passphrase != "" {
+		s.passphrase = []byte(passphrase)
+		return s.passphrase, nil
+	}
+
+	fmt.Print("Passphrase for " + s.filename + ": ")
+	passphrase, err := gopass.GetPasswd()
+	if err != nil || len(passphrase) == 0 {
+		return nil, fmt.Errorf("Need a passphrase")
+	}
+
+	s.passphrase = passphrase
+	return s.passphrase, nil
+}
+
+func deriveKey(passphrase []byte, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+func (s *fileStore) read() ([]*savedToken, error) {
+	data, err := ioutil.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil || len(file.Nonce) != 24 {
+		return nil, fmt.Errorf("Unable to read %v", s.filename)
+	}
+
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], file.Nonce)
+
+	plain, ok := secretbox.Open(nil, file.Data, &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf("Wrong passphrase for %v", s.filename)
+	}
+
+	var tokens []*savedToken
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s *fileStore) write(tokens []*savedToken) error {
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return err
+	}
+
+	file := encryptedFile{
+		Salt:  make([]byte, 16),
+		Nonce: make([]byte, 24),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+
+	key, err := deriveKey(passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], file.Nonce)
+	file.Data = secretbox.Seal(nil, plain, &nonce, key)
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.filename, data, 0600)
+}
+
+func (s *fileStore) get(server string, username string) (string, string, error) {
+	tokens, err := s.read()
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, saved := range tokens {
+		if saved.Server == server && (username == "" || saved.Username == username) {
+			return saved.Username, saved.Token, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+func (s *fileStore) set(server string, username string, token string) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	var kept []*savedToken
+	for _, saved := range tokens {
+		if saved.Server != server || saved.Username != username {
+			kept = append(kept, saved)
+		}
+	}
+
+	return s.write(append(kept, &savedToken{Server: server, Username: username, Token: token}))
+}
+
+func (s *fileStore) remove(server string, username string) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	var kept []*savedToken
+	for _, saved := range tokens {
+		if saved.Server != server || (username != "" && saved.Username != username) {
+			kept = append(kept, saved)
+		}
+	}
+
+	return s.write(kept)
+}
+
+// readNetrc returns the login and password for the host from ~/.netrc,
+// falling back to its default entry.
+func readNetrc(host string) (string, string) {
+	data, err := ioutil.ReadFile(filepath.Join(os.Getenv("HOME"), ".netrc"))
+	if err != nil {
+		return "", ""
+	}
+
+	var login, password string
+	var defaultLogin, defaultPassword string
+	inMachine, inDefault, found := false, false, false
+
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if found {
+				return login, password
+			}
+			i++
+			inMachine = i < len(fields) && fields[i] == host
+			inDefault = false
+			found = inMachine
+		case "default":
+			if found {
+				return login, password
+			}
+			inMachine, inDefault = false, true
+		case "login", "password", "account":
+			key := fields[i]
+			i++
+			if i >= len(fields) {
+				break
+			}
+			if inMachine && key == "login" {
+				login = fields[i]
+			} else if inMachine && key == "password" {
+				password = fields[i]
+			} else if inDefault && key == "login" {
+				defaultLogin = fields[i]
+			} else if inDefault && key == "password" {
+				defaultPassword = fields[i]
+			}
+		}
+	}
+
+	if found {
+		return login, password
+	}
+	return defaultLogin, defaultPassword
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadNetrc(t *testing.T) {
+	home, err := ioutil.TempDir("", "netrc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	if login, password := readNetrc("chat.example.com"); login != "" || password != "" {
+		t.Errorf("no netrc: got %v, %v", login, password)
+	}
+
+	for _, test := range []struct {
+		name     string
+		netrc    string
+		login    string
+		password string
+	}{
+		{
+			name:     "one line",
+			netrc:    "machine chat.example.com login alice password secret\n",
+			login:    "alice",
+			password: "secret",
+		},
+		{
+			name: "several machines",
+			netrc: `machine git.example.com
+  login bob
+  password hunter2
+
+machine chat.example.com
+  login alice
+  account ops
+  password secret
+
+machine other.example.com login carol password nope
+`,
+			login:    "alice",
+			password: "secret",
+		},
+		{
+			name: "default",
+			netrc: `machine git.example.com login bob password hunter2
+default login anonymous password guest
+`,
+			login:    "anonymous",
+			password: "guest",
+		},
+		{
+			name: "machine before default",
+			netrc: `machine chat.example.com login alice password secret
+default login anonymous password guest
+`,
+			login:    "alice",
+			password: "secret",
+		},
+		{
+			name:  "no match",
+			netrc: "machine git.example.com login bob password hunter2\n",
+		},
+		{
+			name:  "similar host",
+			netrc: "machine chat.example.com.evil login eve password stolen\n",
+		},
+		{
+			name:  "login only",
+			netrc: "machine chat.example.com login alice\n",
+			login: "alice",
+		},
+		{
+			name:  "cut short",
+			netrc: "machine chat.example.com login alice password",
+			login: "alice",
+		},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(home, ".netrc"), []byte(test.netrc), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if login, password := readNetrc("chat.example.com"); login != test.login || password != test.password {
+			t.Errorf("%v: got %v, %v, want %v, %v", test.name, login, password, test.login, test.password)
+		}
+	}
+}
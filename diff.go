@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [server] [-- git-diff-args]",
+	Short: "Post a diff summary with each file's changes in a threaded reply",
+	Long: `Post a diff summary with each file's changes in a threaded reply.
+
+The diff is read from --diff, or from git diff run with the arguments after --.
+The full patch is attached to the summary.`,
+	RunE: doDiffCmdF,
+}
+
+func init() {
+	diffCmd.Flags().String("diff", "", "Patch file to post instead of running git diff, - for stdin")
+	diffCmd.Flags().StringP("message", "m", "", "Text to send with the summary")
+	diffCmd.Flags().Int("max-files", 50, "The most files to list in the summary")
+	addDeliveryFlags(diffCmd)
+
+	rootCmd.AddCommand(diffCmd)
+}
+
+// fileDiff is the part of a patch that changes one file.
+type fileDiff struct {
+	name       string
+	text       string
+	insertions int
+	deletions  int
+	binary     bool
+}
+
+func doDiffCmdF(cmd *cobra.Command, args []string) error {
+	diffFile, _ := cmd.Flags().GetString("diff")
+	message, _ := cmd.Flags().GetString("message")
+	maxFiles, _ := cmd.Flags().GetInt("max-files")
+
+	serverArgs, gitArgs := args, []string{}
+	if dash := cmd.ArgsLenAtDash(); dash != -1 {
+		serverArgs, gitArgs = args[:dash], args[dash:]
+	}
+
+	if len(serverArgs) > 1 {
+		return fmt.Errorf("Extra args, put git diff arguments after --")
+	}
+
+	if diffFile != "" && len(gitArgs) != 0 {
+		return fmt.Errorf("Only one of --diff and git diff arguments can be used")
+	}
+
+	targets, err := getPostTargets(cmd, serverArgs)
+	if err != nil {
+		return err
+	}
+
+	var patch, author string
+	if diffFile != "" {
+		var data []byte
+		if diffFile == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(diffFile)
+		}
+		if err != nil {
+			return err
+		}
+		patch = string(data)
+	} else {
+		output, err := exec.Command("git", append([]string{"diff", "--no-color", "--no-ext-diff"}, gitArgs...)...).Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return fmt.Errorf("git diff failed: %v", strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return fmt.Errorf("Unable to run git diff: %v", err.Error())
+		}
+		patch = string(output)
+
+		// A diff of the working tree is the work of whoever is posting it
+		if name, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+			author = strings.TrimSpace(string(name))
+		}
+	}
+
+	preamble, files := parseDiff(patch)
+	if len(files) == 0 {
+		return fmt.Errorf("No changes to post")
+	}
+
+	// Patches from git show or git format-patch say who wrote them
+	if patchAuthor := diffAuthor(preamble); patchAuthor != "" {
+		author = patchAuthor
+	}
+
+	patchFile := diffFile
+	if diffFile == "" || diffFile == "-" {
+		defer removeTempAttachments()
+		if patchFile, err = tempAttachment("changes.patch", []byte(patch)); err != nil {
+			return err
+		}
+	}
+
+	root := &model.Post{
+		Message: message,
+		Type:    model.POST_DEFAULT,
+	}
+	setOverrideProps(cmd, root)
+	root.AddProp("attachments", []*model.SlackAttachment{diffSummary(files, author, maxFiles)})
+
+	posts := []*model.Post{root}
+	for _, file := range files {
+		for _, reply := range diffReplies(file) {
+			post := &model.Post{
+				Message: reply,
+				Type:    model.POST_DEFAULT,
+			}
+			setOverrideProps(cmd, post)
+			posts = append(posts, post)
+		}
+	}
+
+	return postToTargets(cmd, targets, time.Time{}, posts, []string{patchFile}, true)
+}
+
+// parseDiff splits a patch into the changes to each file, returning what came
+// before the first file too. It reads git diffs and plain unified diffs.
+func parseDiff(patch string) (string, []*fileDiff) {
+	lines := strings.SplitAfter(patch, "\n")
+	gitDiff := strings.HasPrefix(patch, "diff --git ") || strings.Contains(patch, "\ndiff --git ")
+
+	var preamble strings.Builder
+	var files []*fileDiff
+	var current *fileDiff
+	var text strings.Builder
+
+	// Lines left in the current hunk, from its @@ header, so changed lines
+	// that look like headers aren't taken for them
+	oldLeft, newLeft := 0, 0
+
+	finish := func() {
+		if current != nil {
+			current.text = text.String()
+			files = append(files, current)
+		}
+		text.Reset()
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		inHunk := oldLeft > 0 || newLeft > 0
+
+		if inHunk {
+			text.WriteString(line)
+			switch {
+			case strings.HasPrefix(trimmed, "+"):
+				current.insertions++
+				newLeft--
+			case strings.HasPrefix(trimmed, "-"):
+				current.deletions++
+				oldLeft--
+			case strings.HasPrefix(trimmed, "\\"):
+				// No newline at end of file
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		starts := false
+		if gitDiff {
+			starts = strings.HasPrefix(trimmed, "diff --git ")
+		} else {
+			starts = strings.HasPrefix(trimmed, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+		}
+
+		if starts {
+			finish()
+			current = &fileDiff{}
+			if gitDiff {
+				current.name = gitDiffName(trimmed)
+			}
+		}
+
+		if current == nil {
+			preamble.WriteString(line)
+			continue
+		}
+
+		text.WriteString(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "@@ "):
+			oldLeft, newLeft = hunkLengths(trimmed)
+		case strings.HasPrefix(trimmed, "+++ "):
+			if name := diffPathName(trimmed[4:]); name != "" {
+				current.name = name
+			}
+		case strings.HasPrefix(trimmed, "--- "):
+			if name := diffPathName(trimmed[4:]); name != "" && current.name == "" {
+				current.name = name
+			}
+		case strings.HasPrefix(trimmed, "Binary files ") || trimmed == "GIT binary patch":
+			current.binary = true
+		}
+	}
+	finish()
+
+	return preamble.String(), files
+}
+
+// hunkLengths reads how many old and new lines a hunk has from its header,
+// like "@@ -1,5 +1,6 @@". A missing length means one line.
+func hunkLengths(header string) (int, int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+
+	length := func(field string) int {
+		if comma := strings.Index(field, ","); comma != -1 {
+			n, _ := strconv.Atoi(field[comma+1:])
+			return n
+		}
+		return 1
+	}
+
+	return length(fields[1]), length(fields[2])
+}
+
+// gitDiffName takes the new file name from a "diff --git a/x b/x" line.
+func gitDiffName(line string) string {
+	if b := strings.LastIndex(line, " b/"); b != -1 {
+		return line[b+3:]
+	}
+	return strings.TrimPrefix(line, "diff --git ")
+}
+
+// diffPathName takes the file name from a "---" or "+++" header, without the
+// a/ or b/ prefix and timestamp.
+func diffPathName(header string) string {
+	if tab := strings.Index(header, "\t"); tab != -1 {
+		header = header[:tab]
+	}
+	header = strings.Trim(header, "\"")
+
+	if header == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(header, "a/") || strings.HasPrefix(header, "b/") {
+		return header[2:]
+	}
+	return header
+}
+
+// diffAuthor finds the author in the headers of git show or git format-patch
+// output.
+func diffAuthor(preamble string) string {
+	for _, line := range strings.Split(preamble, "\n") {
+		for _, prefix := range []string{"Author: ", "From: "} {
+			if strings.HasPrefix(line, prefix) {
+				return strings.TrimSpace(line[len(prefix):])
+			}
+		}
+	}
+	return ""
+}
+
+// diffSummary builds the summary attachment with the totals and the files
+// changed.
+func diffSummary(files []*fileDiff, author string, maxFiles int) *model.SlackAttachment {
+	insertions, deletions := 0, 0
+	var list []string
+	for i, file := range files {
+		insertions += file.insertions
+		deletions += file.deletions
+
+		if maxFiles > 0 && i >= maxFiles {
+			continue
+		}
+		if file.binary {
+			list = append(list, fmt.Sprintf("`%v` binary", file.name))
+		} else {
+			list = append(list, fmt.Sprintf("`%v` +%v -%v", file.name, file.insertions, file.deletions))
+		}
+	}
+	if maxFiles > 0 && len(files) > maxFiles {
+		list = append(list, fmt.Sprintf("and %v more", len(files)-maxFiles))
+	}
+
+	summary := fmt.Sprintf("%v files changed, %v insertions(+), %v deletions(-)", len(files), insertions, deletions)
+
+	fields := []*model.SlackAttachmentField{
+		{Title: "Files changed", Value: len(files), Short: true},
+		{Title: "Insertions", Value: insertions, Short: true},
+		{Title: "Deletions", Value: deletions, Short: true},
+	}
+	if author != "" {
+		fields = append(fields, &model.SlackAttachmentField{Title: "Author", Value: author, Short: true})
+	}
+
+	return &model.SlackAttachment{
+		Fallback: summary,
+		Color:    "#2389d7",
+		Title:    summary,
+		Text:     strings.Join(list, "\n"),
+		Fields:   fields,
+	}
+}
+
+// diffReplies puts the file's changes in diff code blocks, split at hunks, or
+// at lines for very long hunks, so each fits in a post.
+func diffReplies(file *fileDiff) []string {
+	heading := "**" + file.name + "**"
+	if file.binary {
+		return []string{heading + " (binary)"}
+	}
+
+	// Leave room for the heading, a part number and the fences
+	limit := model.POST_MESSAGE_MAX_RUNES - utf8.RuneCountInString(heading) - 40
+	fence := codeFence(file.text)
+
+	var chunks []string
+	var current strings.Builder
+	add := func(piece string) {
+		if current.Len() != 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(piece) > limit-2*len(fence) {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		current.WriteString(piece)
+	}
+
+	for _, hunk := range splitHunks(file.text) {
+		if utf8.RuneCountInString(hunk) <= limit-2*len(fence) {
+			add(hunk)
+			continue
+		}
+		for _, line := range strings.SplitAfter(hunk, "\n") {
+			// Lines longer than a post are cut
+			if runes := []rune(line); len(runes) > limit-2*len(fence) {
+				line = string(runes[:limit-2*len(fence)-1]) + "\n"
+			}
+			add(line)
+		}
+	}
+	if current.Len() != 0 {
+		chunks = append(chunks, current.String())
+	}
+
+	replies := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		title := heading
+		if len(chunks) > 1 {
+			title = fmt.Sprintf("%v (%v/%v)", heading, i+1, len(chunks))
+		}
+		replies[i] = title + "\n" + fence + "diff\n" + strings.TrimRight(chunk, "\n") + "\n" + fence
+	}
+
+	return replies
+}
+
+// splitHunks splits a file's changes into the header and each hunk.
+func splitHunks(text string) []string {
+	var hunks []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(line, "@@") && current.Len() != 0 {
+			hunks = append(hunks, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() != 0 {
+		hunks = append(hunks, current.String())
+	}
+	return hunks
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+)
+
+const testGitPatch = `From 1234abcd Mon Sep 17 00:00:00 2001
+From: Jane Doe <jane@example.com>
+Subject: [PATCH] Update things
+
+diff --git a/main.go b/main.go
+index 83db48f..bf269f4 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+-var a = 1
++var a = 2
++var b = 3
+ 
+@@ -10 +11 @@ func main() {
+-	run()
++	start()
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..e69de29
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++--- not a header
+++++ not a header
+diff --git a/logo.png b/logo.png
+index 1111111..2222222 100644
+Binary files a/logo.png and b/logo.png differ
+`
+
+const testUnifiedPatch = `Only in old: notes
+--- old/readme.txt	2017-03-15 10:30:00.000000000 +0000
++++ new/readme.txt	2017-03-15 10:31:00.000000000 +0000
+@@ -1,2 +1,2 @@
+--- rule
++=== rule
+ text
+--- old/gone.txt	2017-03-15 10:30:00.000000000 +0000
++++ /dev/null	1970-01-01 00:00:00.000000000 +0000
+@@ -1 +0,0 @@
+-bye
+`
+
+func TestParseDiff(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		patch    string
+		preamble string
+		files    []fileDiff
+	}{
+		{
+			name:     "git",
+			patch:    testGitPatch,
+			preamble: "From 1234abcd Mon Sep 17 00:00:00 2001\nFrom: Jane Doe <jane@example.com>\nSubject: [PATCH] Update things\n\n",
+			files: []fileDiff{
+				{name: "main.go", insertions: 3, deletions: 2},
+				{name: "new.txt", insertions: 2},
+				{name: "logo.png", binary: true},
+			},
+		},
+		{
+			name:     "unified",
+			patch:    testUnifiedPatch,
+			preamble: "Only in old: notes\n",
+			files: []fileDiff{
+				{name: "new/readme.txt", insertions: 1, deletions: 1},
+				{name: "old/gone.txt", deletions: 1},
+			},
+		},
+		{
+			name:     "no changes",
+			patch:    "nothing here\n",
+			preamble: "nothing here\n",
+		},
+	} {
+		preamble, files := parseDiff(test.patch)
+		if preamble != test.preamble {
+			t.Errorf("%v: got preamble %q, want %q", test.name, preamble, test.preamble)
+		}
+
+		if len(files) != len(test.files) {
+			t.Errorf("%v: got %v files, want %v", test.name, len(files), len(test.files))
+			continue
+		}
+		for i, file := range files {
+			want := test.files[i]
+			if file.name != want.name || file.insertions != want.insertions || file.deletions != want.deletions || file.binary != want.binary {
+				t.Errorf("%v: got file %v +%v -%v binary %v, want %v +%v -%v binary %v", test.name,
+					file.name, file.insertions, file.deletions, file.binary, want.name, want.insertions, want.deletions, want.binary)
+			}
+		}
+	}
+
+	// Each file's text is the patch without the preamble
+	preamble, files := parseDiff(testGitPatch)
+	text := preamble
+	for _, file := range files {
+		text += file.text
+	}
+	if text != testGitPatch {
+		t.Errorf("file texts don't add up to the patch: %q", text)
+	}
+
+	if author := diffAuthor(preamble); author != "Jane Doe <jane@example.com>" {
+		t.Errorf("got author %q", author)
+	}
+}
+
+func TestDiffReplies(t *testing.T) {
+	if replies := diffReplies(&fileDiff{name: "logo.png", binary: true}); len(replies) != 1 || replies[0] != "**logo.png** (binary)" {
+		t.Errorf("binary: got %q", replies)
+	}
+
+	short := &fileDiff{name: "main.go", text: "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n"}
+	want := "**main.go**\n```diff\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n```"
+	if replies := diffReplies(short); len(replies) != 1 || replies[0] != want {
+		t.Errorf("short: got %q, want %q", replies, want)
+	}
+
+	fenced := &fileDiff{name: "README.md", text: "@@ -1 +1 @@\n-```go\n+```\n"}
+	if replies := diffReplies(fenced); len(replies) != 1 || !strings.Contains(replies[0], "\n````diff\n") || !strings.HasSuffix(replies[0], "\n````") {
+		t.Errorf("fenced: got %q", replies)
+	}
+
+	// Hunks that don't fit together are split between posts, and a hunk that
+	// doesn't fit in one is split at lines
+	hunk := "@@ -1,100 +1,100 @@\n" + strings.Repeat("+"+strings.Repeat("x", 59)+"\n", 50)
+	huge := "@@ -200,300 +200,300 @@\n" + strings.Repeat("-"+strings.Repeat("y", 59)+"\n", 150)
+	long := &fileDiff{name: "big.txt", text: hunk + hunk + huge}
+
+	replies := diffReplies(long)
+	if len(replies) < 4 {
+		t.Fatalf("long: got %v replies, want at least 4", len(replies))
+	}
+
+	var joined strings.Builder
+	for i, reply := range replies {
+		if utf8.RuneCountInString(reply) > model.POST_MESSAGE_MAX_RUNES {
+			t.Errorf("long: reply %v is %v runes", i+1, utf8.RuneCountInString(reply))
+		}
+
+		lines := strings.SplitAfter(reply, "\n")
+		if !strings.HasPrefix(lines[0], "**big.txt** (") || lines[1] != "```diff\n" || lines[len(lines)-1] != "```" {
+			t.Errorf("long: reply %v isn't a titled diff block: %q", i+1, reply[:40])
+			continue
+		}
+		joined.WriteString(strings.Join(lines[2:len(lines)-1], ""))
+	}
+	if joined.String() != long.text {
+		t.Error("long: the replies don't add up to the changes")
+	}
+	if !strings.HasPrefix(replies[1], "**big.txt** (2/") || !strings.Contains(replies[1], "\n@@ -1,100 +1,100 @@\n") {
+		t.Errorf("long: second hunk isn't in its own reply: %q", replies[1][:60])
+	}
+}
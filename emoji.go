@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+)
+
+// systemEmoji holds the names of the commonly used emoji that are built in to
+// Mattermost. Names not in this list are checked against the custom emoji on
+// the server.
+var systemEmoji = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		+1 -1 thumbsup thumbsdown ok_hand clap wave raised_hands pray muscle
+		point_up point_down point_left point_right v fist facepunch punch
+		smile smiley grinning grin laughing satisfied joy rofl sweat_smile
+		wink blush innocent slightly_smiling_face upside_down_face relieved
+		heart_eyes kissing_heart yum stuck_out_tongue sunglasses nerd_face
+		thinking thinking_face neutral_face expressionless unamused roll_eyes
+		smirk grimacing confused worried slightly_frowning_face frowning
+		disappointed cry sob scream fearful cold_sweat rage angry triumph
+		sleeping sleepy mask dizzy_face astonished open_mouth hushed
+		exploding_head partying_face shrug facepalm skull ghost alien robot
+		poop hankey see_no_evil hear_no_evil speak_no_evil
+		heart yellow_heart green_heart blue_heart purple_heart black_heart
+		broken_heart sparkling_heart two_hearts 100 fire star star2 sparkles
+		zap boom collision tada confetti_ball balloon gift trophy medal
+		rocket airplane car bus ship anchor construction rotating_light
+		warning no_entry no_entry_sign x heavy_check_mark white_check_mark
+		ballot_box_with_check heavy_multiplication_x question grey_question
+		exclamation grey_exclamation bangbang interrobang heavy_plus_sign
+		heavy_minus_sign arrow_up arrow_down arrow_left arrow_right
+		arrows_counterclockwise repeat recycle hourglass hourglass_flowing_sand
+		stopwatch alarm_clock clock1 calendar date memo pencil pencil2
+		paperclip pushpin round_pushpin lock unlock key bell no_bell mag
+		mag_right bulb wrench hammer gear link chart_with_upwards_trend
+		chart_with_downwards_trend bar_chart clipboard package inbox_tray
+		outbox_tray email envelope speech_balloon thought_balloon eyes eye
+		bug ant beetle snail turtle snake dragon whale dolphin octopus
+		cat dog monkey panda_face penguin bird chicken unicorn sheep
+		coffee tea beer beers wine_glass cocktail pizza hamburger cake
+		cookie doughnut apple banana
+		sunny cloud umbrella snowflake rainbow ocean earth_americas
+		red_circle large_blue_circle white_circle black_circle
+		green_circle yellow_circle orange_circle large_orange_diamond
+		large_blue_diamond small_red_triangle small_red_triangle_down
+		new free up cool sos ok information_source on end soon top back
+		checkered_flag triangular_flag_on_post white_flag black_flag
+		lock_with_ink_pen closed_lock_with_key shield stop_sign
+		hand raised_hand writing_hand handshake crossed_fingers
+		man woman person_frowning bow ok_woman no_good
+	`) {
+		systemEmoji[name] = true
+	}
+}
+
+// validateEmoji checks that the emoji name is either built in to Mattermost
+// or one of the custom emoji on the server. Names can't be checked when custom
+// emoji are disabled, so those are allowed with a warning.
+func validateEmoji(client *model.Client4, name string) error {
+	if systemEmoji[name] {
+		return nil
+	}
+
+	for page := 0; ; page++ {
+		emojis, resp := client.GetEmojiList(page, 200)
+		if resp.Error != nil {
+			// Custom emoji may be disabled on the server, and the built in
+			// list above is only partial, so let the server decide
+			if resp.StatusCode == 501 {
+				fmt.Println("Unable to check emoji " + name + ", custom emoji are disabled on the server")
+				return nil
+			}
+			return resp.Error
+		}
+
+		for _, emoji := range emojis {
+			if emoji.Name == name {
+				return nil
+			}
+		}
+
+		if len(emojis) < 200 {
+			break
+		}
+	}
+
+	return fmt.Errorf("Unknown emoji: %v", name)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+// postTarget is one channel to post to.
+type postTarget struct {
+	Server  string
+	Team    string
+	Channel string
+}
+
+// postProfile lists the servers, teams and channels to post to, like:
+//
+//	[[target]]
+//	server = "https://chat.example.com"
+//	team = "eng"
+//	channels = ["announcements", "town-square"]
+type postProfile struct {
+	Targets []profileTarget `toml:"target"`
+}
+
+type profileTarget struct {
+	Server   string   `toml:"server"`
+	Team     string   `toml:"team"`
+	Channels []string `toml:"channels"`
+}
+
+// getPostTargets collects the channels to post to from the channel flags and
+// channel file for the server argument, and from the profile.
+func getPostTargets(cmd *cobra.Command, args []string) ([]*postTarget, error) {
+	channels, _ := cmd.Flags().GetStringArray("channel")
+	channelFile, _ := cmd.Flags().GetString("channel-file")
+	teamName, _ := cmd.Flags().GetString("team")
+	profile, _ := cmd.Flags().GetString("profile")
+
+	if channelFile != "" {
+		fileChannels, err := readChannelFile(channelFile)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, fileChannels...)
+	}
+
+	var targets []*postTarget
+	if len(args) > 0 {
+		if len(channels) == 0 {
+			return nil, fmt.Errorf("Need a channel")
+		}
+		for _, channel := range channels {
+			targets = append(targets, &postTarget{Server: args[0], Team: teamName, Channel: channel})
+		}
+	} else if len(channels) != 0 {
+		return nil, fmt.Errorf("Need a server URL for the channels given on the command line")
+	}
+
+	if profile != "" {
+		data, err := ioutil.ReadFile(profile)
+		if err != nil {
+			return nil, err
+		}
+
+		var parsed postProfile
+		if err := toml.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("Unable to read profile %v: %v", profile, err.Error())
+		}
+
+		for _, target := range parsed.Targets {
+			if target.Server == "" {
+				return nil, fmt.Errorf("Target without a server in profile %v", profile)
+			}
+			for _, channel := range target.Channels {
+				targets = append(targets, &postTarget{Server: target.Server, Team: target.Team, Channel: channel})
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("Need a channel")
+	}
+
+	return targets, nil
+}
+
+// readChannelFile reads a channel on each line, skipping blank lines and
+// comments.
+func readChannelFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var channels []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			channels = append(channels, line)
+		}
+	}
+
+	return channels, scanner.Err()
+}
+
+type postResult struct {
+	target *postTarget
+	err    error
+	spool  string
+}
+
+// postToTargets posts a copy of the posts, in order, to every target. It logs
+// in to each server once, then sends the posts with a bounded number of
+// workers. The attachments go on the first post, and every channel gets its
+// own upload of them, as uploads belong to a channel. With thread, the posts
+// after the first are replies to it. Posts that fail because a server is
+// unreachable are saved to the outbox, along with the ones after them so they
+// stay in order and in their thread, and errSpooled is returned when nothing
+// else failed.
+func postToTargets(cmd *cobra.Command, targets []*postTarget, postAt time.Time, templates []*model.Post, attachments []string, thread bool) error {
+	workers, _ := cmd.Flags().GetInt("workers")
+	outbox, _ := cmd.Flags().GetString("outbox")
+	checkMentionsMode, _ := cmd.Flags().GetString("check-mentions")
+
+	if checkMentionsMode != "warn" && checkMentionsMode != "fail" && checkMentionsMode != "off" {
+		return fmt.Errorf("Unknown --check-mentions mode: %v", checkMentionsMode)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Logins may prompt, so they happen one at a time before any posting
+	type session struct {
+		client *model.Client4
+		user   *model.User
+		err    error
+	}
+	sessions := map[string]*session{}
+	for _, target := range targets {
+		if _, ok := sessions[target.Server]; !ok {
+			client, user, err := login(cmd, target.Server)
+			sessions[target.Server] = &session{client, user, err}
+			if err == nil {
+				warnDisabledOverrides(client, templates[0])
+			}
+		}
+	}
+
+	if !postAt.IsZero() {
+		fmt.Println("Posting at " + postAt.Format("2006-01-02 15:04:05"))
+		time.Sleep(postAt.Sub(time.Now()))
+	}
+
+	results := make([]*postResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				target := targets[i]
+
+				result := &postResult{target: target}
+				results[i] = result
+
+				session := sessions[target.Server]
+				var channel *model.Channel
+				if result.err = session.err; result.err == nil {
+					channel, result.err = lookupChannel(session.client, target.Channel, target.Team)
+				}
+
+				rootId, rootPendingId := "", ""
+				for j, template := range templates {
+					// The pending post ID stays the same if the post has to be
+					// retried from the outbox, so the server never creates it twice
+					post := *template
+					post.PendingPostId = model.NewId()
+					if j == 0 {
+						rootPendingId = post.PendingPostId
+					}
+
+					// Replies to a root that was saved to the outbox have no root
+					// ID yet, so their entries name the root's pending post ID
+					// for the flush to fill in
+					replyTo := ""
+					if thread && j != 0 {
+						post.RootId = rootId
+						if rootId == "" {
+							replyTo = rootPendingId
+						}
+					}
+
+					postAttachments := attachments
+					if j != 0 {
+						postAttachments = nil
+					}
+
+					if result.err == nil {
+						result.err = checkMentions(cmd, session.client, channel, post.Message)
+						if result.err == nil {
+							post.UserId = session.user.Id
+							post.ChannelId = channel.Id
+							var created *model.Post
+							if created, result.err = sendPost(session.client, &post, postAttachments); result.err == nil && j == 0 {
+								rootId = created.Id
+							}
+						}
+						if result.err == nil {
+							continue
+						}
+					}
+
+					if outbox == "" || !isUnreachable(result.err) {
+						break
+					}
+					dir, err := spoolPost(outbox, target.Server, target.Channel, target.Team, &post, replyTo, postAttachments)
+					if err != nil {
+						break
+					}
+					if result.spool == "" {
+						result.spool = dir
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// A single post reports like it always has, without a table
+	if len(results) == 1 {
+		result := results[0]
+		if result.spool != "" {
+			fmt.Println("Server unreachable, saved post to the outbox: " + result.spool)
+			fmt.Println(" Error: " + result.err.Error())
+			return errSpooled
+		}
+		return result.err
+	}
+
+	failed, spooled := 0, 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tCHANNEL\tRESULT")
+	for _, result := range results {
+		status := "OK"
+		if result.spool != "" {
+			status = "SAVED TO OUTBOX: " + result.err.Error()
+			spooled++
+		} else if result.err != nil {
+			status = "FAILED: " + result.err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", result.target.Server, result.target.Channel, status)
+	}
+	w.Flush()
+
+	if failed != 0 {
+		return fmt.Errorf("%v of %v posts failed", failed, len(results))
+	}
+	if spooled != 0 {
+		return errSpooled
+	}
+
+	return nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+const hookMarker = "# Installed by mattermost-poster install-hook"
+
+// hookFlags are the flags copied from install-hook into the hooks it writes.
+// Passwords and tokens are left out so they don't end up in the repository.
+var hookFlags = []string{
+	"username", "auth", "team", "channel", "channel-file", "profile",
+	"retries", "retry-max-wait", "ca-cert", "client-cert", "client-key",
+	"insecure-skip-verify", "proxy", "timeout",
+	"outbox", "as-username", "icon-url", "check-mentions",
+	"compare-url", "template", "max-commits",
+}
+
+// defaultHookTemplate is the post for each branch updated.
+const defaultHookTemplate = `**{{.Repo}}** {{if .Deleted}}deleted branch ` + "`{{.Branch}}`" + `{{else}}{{if .Created}}new branch {{end}}` + "`{{.Branch}}`" + `: {{.Total}} {{if eq .Total 1}}commit{{else}}commits{{end}} by {{join .Authors ", "}}{{if .CompareUrl}} ([compare]({{.CompareUrl}})){{end}}
+{{range .Commits}}
+- ` + "`{{.ShortSha}}`" + ` {{.Subject}} - {{.Author}}{{end}}{{if .More}}
+- and {{.More}} more{{end}}{{end}}`
+
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook [server]",
+	Short: "Install git hooks that post commits, merges and pushes",
+	Long: `Install git hooks that post commits, merges and pushes.
+
+The hooks post in the background so git isn't held up, and posts are saved to
+the outbox while the server is unreachable and delivered by the next hook run.
+Passwords aren't saved in the hooks, so use the login subcommand or ~/.netrc
+for the account the hooks run as.`,
+	RunE: doInstallHookCmdF,
+}
+
+var hookRunCmd = &cobra.Command{
+	Use:    "hook-run [hook] [server]",
+	Short:  "Post for a git hook, run by the hooks install-hook writes",
+	Hidden: true,
+	RunE:   doHookRunCmdF,
+}
+
+func init() {
+	installHookCmd.Flags().StringArray("hook", []string{"post-commit"}, "Hook to install: post-commit, post-merge or post-receive, can be repeated")
+	installHookCmd.Flags().String("repo", "", "The repository to install the hooks in (default the current one)")
+	installHookCmd.Flags().Bool("force", false, "Replace existing hooks that weren't installed by mattermost-poster")
+	addHookRunFlags(installHookCmd)
+
+	addHookRunFlags(hookRunCmd)
+
+	rootCmd.AddCommand(installHookCmd, hookRunCmd)
+}
+
+func addHookRunFlags(cmd *cobra.Command) {
+	cmd.Flags().String("compare-url", "", "Link to compare the changes, with {repo}, {branch}, {from} and {to} replaced, like https://git.example.com/{repo}/compare/{from}...{to}")
+	cmd.Flags().String("template", "", "Go template file for the post instead of the built in one")
+	cmd.Flags().Int("max-commits", 20, "The most commits to list in a post")
+	addDeliveryFlags(cmd)
+}
+
+// hookCommit is a commit listed in a hook post.
+type hookCommit struct {
+	Sha      string
+	ShortSha string
+	Author   string
+	Subject  string
+}
+
+// hookUpdate is a branch changed by a commit, merge or push, as given to the
+// post template.
+type hookUpdate struct {
+	Repo       string
+	Branch     string
+	From       string
+	To         string
+	Created    bool
+	Deleted    bool
+	Commits    []*hookCommit
+	Authors    []string
+	Total      int
+	More       int
+	CompareUrl string
+}
+
+// runGit runs git and returns its output without the trailing newline.
+func runGit(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) != 0 {
+			return "", fmt.Errorf("git %v failed: %v", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("Unable to run git %v: %v", args[0], err.Error())
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// shellQuote quotes the argument for a POSIX shell.
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func doInstallHookCmdF(cmd *cobra.Command, args []string) error {
+	hooks, _ := cmd.Flags().GetStringArray("hook")
+	repo, _ := cmd.Flags().GetString("repo")
+	force, _ := cmd.Flags().GetBool("force")
+	profile, _ := cmd.Flags().GetString("profile")
+
+	if len(args) < 1 && profile == "" {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	for _, hook := range hooks {
+		if hook != "post-commit" && hook != "post-merge" && hook != "post-receive" {
+			return fmt.Errorf("Unknown hook: %v", hook)
+		}
+	}
+
+	// Check the targets now rather than when the first hook runs
+	if _, err := getPostTargets(cmd, args); err != nil {
+		return err
+	}
+
+	for _, secret := range []string{"password", "token", "mfa-token"} {
+		if cmd.Flags().Changed(secret) {
+			fmt.Println("Warning: --" + secret + " isn't saved in hooks, use the login subcommand for the account the hooks run as")
+		}
+	}
+
+	gitArgs := []string{"rev-parse", "--git-path", "hooks"}
+	if repo != "" {
+		gitArgs = append([]string{"-C", repo}, gitArgs...)
+	}
+	hooksDir, err := runGit(gitArgs...)
+	if err != nil {
+		return err
+	}
+	if repo != "" && !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(repo, hooksDir)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// Relative paths in the flags would be relative to wherever git runs
+	// the hook, so make them absolute
+	var command []string
+	command = append(command, args...)
+	for _, name := range hookFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+
+		values := []string{flag.Value.String()}
+		if flag.Value.Type() == "stringArray" {
+			values, _ = cmd.Flags().GetStringArray(name)
+		}
+
+		for _, value := range values {
+			switch name {
+			case "channel-file", "profile", "template", "ca-cert", "client-cert", "client-key", "outbox":
+				if value != "" {
+					if value, err = filepath.Abs(value); err != nil {
+						return err
+					}
+				}
+			}
+			command = append(command, "--"+name+"="+value)
+		}
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		filename := filepath.Join(hooksDir, hook)
+
+		if existing, err := ioutil.ReadFile(filename); err == nil && !force && !bytes.Contains(existing, []byte(hookMarker)) {
+			return fmt.Errorf("%v already exists, use --force to replace it", filename)
+		}
+
+		if err := ioutil.WriteFile(filename, []byte(hookScript(executable, hook, command)), 0755); err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(filename, 0755); err != nil {
+			return err
+		}
+
+		fmt.Println("Installed " + filename)
+	}
+
+	return nil
+}
+
+// hookScript writes the hook. It runs the poster in the background with its
+// output in a log file, so git never waits for the server. The post-receive
+// hook reads the updated refs from stdin before git closes it.
+func hookScript(executable string, hook string, args []string) string {
+	run := shellQuote(executable) + " hook-run " + shellQuote(hook)
+	for _, arg := range args {
+		run += " " + shellQuote(arg)
+	}
+
+	script := "#!/bin/sh\n" + hookMarker + "\n\n"
+	script += "log=\"$(git rev-parse --git-dir)/mattermost-poster.log\"\n"
+
+	if hook == "post-receive" {
+		script += "input=$(cat)\n"
+		script += "printf '%s\\n' \"$input\" | nohup " + run + " >>\"$log\" 2>&1 &\n"
+	} else {
+		script += "nohup " + run + " </dev/null >>\"$log\" 2>&1 &\n"
+	}
+
+	return script
+}
+
+func doHookRunCmdF(cmd *cobra.Command, args []string) error {
+	outbox, _ := cmd.Flags().GetString("outbox")
+	templateFile, _ := cmd.Flags().GetString("template")
+
+	if len(args) < 1 {
+		return fmt.Errorf("Need a hook name")
+	}
+	hook, serverArgs := args[0], args[1:]
+
+	if len(serverArgs) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	targets, err := getPostTargets(cmd, serverArgs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(time.Now().Format("2006-01-02 15:04:05") + " " + hook)
+
+	var updates []*hookUpdate
+	switch hook {
+	case "post-commit":
+		branch, err := runGit("symbolic-ref", "--short", "-q", "HEAD")
+		if err != nil {
+			branch = "detached HEAD"
+		}
+		from, _ := runGit("rev-parse", "-q", "--verify", "HEAD^")
+		to, err := runGit("rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		update, err := newHookUpdate(cmd, branch, from, to, []string{"-n", "1", to})
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update)
+	case "post-merge":
+		branch, err := runGit("symbolic-ref", "--short", "-q", "HEAD")
+		if err != nil {
+			branch = "detached HEAD"
+		}
+		from, err := runGit("rev-parse", "ORIG_HEAD")
+		if err != nil {
+			return err
+		}
+		to, err := runGit("rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		update, err := newHookUpdate(cmd, branch, from, to, []string{from + ".." + to})
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update)
+	case "post-receive":
+		if updates, err = readPushedRefs(cmd); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown hook: %v", hook)
+	}
+
+	text := defaultHookTemplate
+	if templateFile != "" {
+		data, err := ioutil.ReadFile(templateFile)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("hook").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return fmt.Errorf("Unable to read template: %v", err.Error())
+	}
+
+	var posts []*model.Post
+	for _, update := range updates {
+		if update.Total == 0 && !update.Deleted {
+			continue
+		}
+
+		message := &bytes.Buffer{}
+		if err := tmpl.Execute(message, update); err != nil {
+			return fmt.Errorf("Unable to render template: %v", err.Error())
+		}
+
+		post := &model.Post{
+			Message: strings.TrimSpace(message.String()),
+			Type:    model.POST_DEFAULT,
+		}
+		setOverrideProps(cmd, post)
+		posts = append(posts, post)
+	}
+
+	if len(posts) == 0 {
+		return nil
+	}
+
+	// Deliver what earlier runs saved first, so posts stay in order
+	if outbox != "" {
+		flushed := map[string]bool{}
+		for _, target := range targets {
+			if !flushed[target.Server] {
+				flushed[target.Server] = true
+				if err := flushOutbox(cmd, target.Server, outbox); err != nil {
+					fmt.Println("Unable to deliver the outbox for " + target.Server)
+					fmt.Println(" Error: " + err.Error())
+				}
+			}
+		}
+	}
+
+	return postToTargets(cmd, targets, time.Time{}, posts, nil, false)
+}
+
+// readPushedRefs reads the "old new ref" lines git gives post-receive on
+// stdin. Only branches are posted.
+func readPushedRefs(cmd *cobra.Command) ([]*hookUpdate, error) {
+	var updates []*hookUpdate
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "refs/heads/") {
+			continue
+		}
+		from, to, ref := fields[0], fields[1], fields[2]
+		branch := strings.TrimPrefix(ref, "refs/heads/")
+
+		if isZeroSha(to) {
+			update, err := newHookUpdate(cmd, branch, from, "", nil)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, update)
+			continue
+		}
+
+		logArgs := []string{from + ".." + to}
+		if isZeroSha(from) {
+			// A new branch lists the commits no other branch has
+			logArgs = []string{to, "--not"}
+			refs, err := runGit("for-each-ref", "--format=%(refname)", "refs/heads/")
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range strings.Split(refs, "\n") {
+				if other != "" && other != ref {
+					logArgs = append(logArgs, other)
+				}
+			}
+		}
+
+		update, err := newHookUpdate(cmd, branch, from, to, logArgs)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, scanner.Err()
+}
+
+func isZeroSha(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// newHookUpdate collects the commits git log finds with the arguments for the
+// branch update. A nil logArgs means the branch was deleted.
+func newHookUpdate(cmd *cobra.Command, branch string, from string, to string, logArgs []string) (*hookUpdate, error) {
+	compareUrl, _ := cmd.Flags().GetString("compare-url")
+	maxCommits, _ := cmd.Flags().GetInt("max-commits")
+
+	update := &hookUpdate{
+		Repo:    repoName(),
+		Branch:  branch,
+		From:    from,
+		To:      to,
+		Created: isZeroSha(from),
+		Deleted: logArgs == nil,
+	}
+	if update.Deleted {
+		return update, nil
+	}
+
+	count, err := runGit(append([]string{"rev-list", "--count"}, logArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	update.Total, _ = strconv.Atoi(count)
+
+	log, err := runGit(append([]string{"log", "--format=%H%x00%h%x00%an%x00%s", "-n", strconv.Itoa(maxCommits)}, logArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	seenAuthors := map[string]bool{}
+	for _, line := range strings.Split(log, "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+
+		commit := &hookCommit{Sha: fields[0], ShortSha: fields[1], Author: fields[2], Subject: fields[3]}
+		update.Commits = append(update.Commits, commit)
+		if !seenAuthors[commit.Author] {
+			seenAuthors[commit.Author] = true
+			update.Authors = append(update.Authors, commit.Author)
+		}
+	}
+	update.More = update.Total - len(update.Commits)
+
+	if compareUrl != "" && !update.Created && from != "" {
+		update.CompareUrl = strings.NewReplacer(
+			"{repo}", update.Repo,
+			"{branch}", branch,
+			"{from}", from,
+			"{to}", to,
+		).Replace(compareUrl)
+	}
+
+	return update, nil
+}
+
+// repoName is the name of the repository's directory, without .git for bare
+// repositories.
+func repoName() string {
+	if toplevel, err := runGit("rev-parse", "--show-toplevel"); err == nil && toplevel != "" {
+		return filepath.Base(toplevel)
+	}
+
+	gitDir, err := runGit("rev-parse", "--git-dir")
+	if err != nil {
+		return ""
+	}
+	if absolute, err := filepath.Abs(gitDir); err == nil {
+		gitDir = absolute
+	}
+
+	name := filepath.Base(gitDir)
+	if name == ".git" {
+		name = filepath.Base(filepath.Dir(gitDir))
+	}
+	return strings.TrimSuffix(name, ".git")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	userMentionRegexp    = regexp.MustCompile(`(?:^|[^\w@])@([a-zA-Z0-9.\-_]+)`)
+	channelMentionRegexp = regexp.MustCompile(`(?:^|[^\w~])~([a-z0-9\-_]+)`)
+	codeRegexp           = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+)
+
+// specialMentions notify a whole channel rather than a user.
+var specialMentions = map[string]bool{
+	"all":     true,
+	"channel": true,
+	"here":    true,
+}
+
+// findMentions returns the usernames and channel names mentioned in the
+// message, ignoring anything inside code.
+func findMentions(message string) ([]string, []string) {
+	message = codeRegexp.ReplaceAllString(message, " ")
+
+	var usernames, channelNames []string
+	seen := map[string]bool{}
+
+	for _, match := range userMentionRegexp.FindAllStringSubmatch(message, -1) {
+		// Sentence punctuation isn't part of the username
+		username := strings.ToLower(strings.TrimRight(match[1], ".-_"))
+		if username != "" && !specialMentions[username] && !seen["@"+username] {
+			seen["@"+username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	for _, match := range channelMentionRegexp.FindAllStringSubmatch(message, -1) {
+		name := strings.TrimRight(match[1], "-_")
+		if name != "" && !seen["~"+name] {
+			seen["~"+name] = true
+			channelNames = append(channelNames, name)
+		}
+	}
+
+	return usernames, channelNames
+}
+
+// checkMentions makes sure the users mentioned in the message exist and are
+// members of the channel, so they'll actually be notified, and that the
+// mentioned channels exist. Problems are warnings, or errors with
+// --check-mentions fail. With --add-mentioned-to-channel, mentioned users
+// outside the channel are added to it.
+func checkMentions(cmd *cobra.Command, client *model.Client4, channel *model.Channel, message string) error {
+	mode, _ := cmd.Flags().GetString("check-mentions")
+	addToChannel, _ := cmd.Flags().GetBool("add-mentioned-to-channel")
+
+	if mode == "off" {
+		return nil
+	}
+
+	usernames, channelNames := findMentions(message)
+	if len(usernames) == 0 && len(channelNames) == 0 {
+		return nil
+	}
+
+	// The check is best effort, so when the lookups fail only
+	// --check-mentions fail stops the post
+	checkFailed := func(err *model.AppError) error {
+		if mode == "fail" {
+			return err
+		}
+		fmt.Println("Warning: unable to check mentions: " + err.Error())
+		return nil
+	}
+
+	var problems []string
+
+	if len(usernames) != 0 {
+		users, resp := client.GetUsersByUsernames(usernames)
+		if resp.Error != nil {
+			return checkFailed(resp.Error)
+		}
+
+		found := map[string]*model.User{}
+		var userIds []string
+		for _, user := range users {
+			found[user.Username] = user
+			userIds = append(userIds, user.Id)
+		}
+
+		for _, username := range usernames {
+			if found[username] == nil {
+				problems = append(problems, "@"+username+" is not a user")
+			}
+		}
+
+		members := map[string]bool{}
+		if len(userIds) != 0 {
+			channelMembers, resp := client.GetChannelMembersByIds(channel.Id, userIds)
+			if resp.Error != nil {
+				return checkFailed(resp.Error)
+			}
+			for _, member := range *channelMembers {
+				members[member.UserId] = true
+			}
+		}
+
+		for _, username := range usernames {
+			user := found[username]
+			if user == nil || members[user.Id] {
+				continue
+			}
+
+			if addToChannel {
+				if _, resp := client.AddChannelMember(channel.Id, user.Id); resp.Error != nil {
+					problems = append(problems, "@"+username+" could not be added to ~"+channel.Name+": "+resp.Error.Error())
+				} else {
+					fmt.Println("Added @" + username + " to ~" + channel.Name)
+				}
+				continue
+			}
+
+			problems = append(problems, "@"+username+" is not a member of ~"+channel.Name+" and won't be notified")
+		}
+	}
+
+	for _, name := range channelNames {
+		if _, resp := client.GetChannelByName(name, channel.TeamId, ""); resp.Error != nil {
+			problems = append(problems, "~"+name+" is not a channel")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if mode == "fail" {
+		return fmt.Errorf("Mention problems: %v", strings.Join(problems, "; "))
+	}
+
+	for _, problem := range problems {
+		fmt.Println("Warning: " + problem)
+	}
+
+	return nil
+}
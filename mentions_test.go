@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+func TestFindMentions(t *testing.T) {
+	for _, test := range []struct {
+		message      string
+		usernames    []string
+		channelNames []string
+	}{
+		{"hi @alice and @Bob.", []string{"alice", "bob"}, nil},
+		{"@alice, @alice and @ALICE", []string{"alice"}, nil},
+		{"mail bob@example.com", nil, nil},
+		{"@all @here @channel", nil, nil},
+		{"thanks @first.last_!", []string{"first.last"}, nil},
+		{"see ~ops and ~dev-team.", nil, []string{"ops", "dev-team"}},
+		{"`@alice` and\n```\n@bob ~ops\n```\n@carol", []string{"carol"}, nil},
+		{"(@alice) ask ~ops-", []string{"alice"}, []string{"ops"}},
+		{"no mentions here", nil, nil},
+	} {
+		usernames, channelNames := findMentions(test.message)
+		if !reflect.DeepEqual(usernames, test.usernames) || !reflect.DeepEqual(channelNames, test.channelNames) {
+			t.Errorf("%q: got %v %v, want %v %v", test.message, usernames, channelNames, test.usernames, test.channelNames)
+		}
+	}
+}
+
+// mentionServer knows the users alice, who is in the channel, and carol, who
+// isn't, and the channel ops.
+type mentionServer struct {
+	broken bool
+	added  []string
+}
+
+func (s *mentionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	channel := "/api/v4/channels/" + strings.Repeat("c", 26)
+	users := map[string]*model.User{
+		"alice": {Id: strings.Repeat("a", 26), Username: "alice"},
+		"carol": {Id: strings.Repeat("d", 26), Username: "carol"},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case s.broken:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(model.NewAppError("", "api.context.500.app_error", nil, "", http.StatusInternalServerError).ToJson()))
+	case r.URL.Path == "/api/v4/users/usernames":
+		var found []*model.User
+		for _, username := range model.ArrayFromJson(r.Body) {
+			if user := users[username]; user != nil {
+				found = append(found, user)
+			}
+		}
+		w.Write([]byte(model.UserListToJson(found)))
+	case r.URL.Path == channel+"/members/ids":
+		json.NewEncoder(w).Encode([]*model.ChannelMember{{ChannelId: strings.Repeat("c", 26), UserId: users["alice"].Id}})
+	case r.URL.Path == channel+"/members":
+		member := model.MapFromJson(r.Body)
+		s.added = append(s.added, member["user_id"])
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte((&model.ChannelMember{UserId: member["user_id"]}).ToJson()))
+	case r.URL.Path == "/api/v4/teams/"+strings.Repeat("t", 26)+"/channels/name/ops":
+		w.Write([]byte((&model.Channel{Name: "ops"}).ToJson()))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(model.NewAppError("", "api.context.404.app_error", nil, "", http.StatusNotFound).ToJson()))
+	}
+}
+
+func TestCheckMentions(t *testing.T) {
+	channel := &model.Channel{Id: strings.Repeat("c", 26), TeamId: strings.Repeat("t", 26), Name: "general"}
+	problems := "Mention problems: @nobody is not a user; @carol is not a member of ~general and won't be notified; ~nowhere is not a channel"
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		message string
+		broken  bool
+		err     string
+		added   []string
+	}{
+		{"fine", []string{"--check-mentions", "fail"}, "@alice see ~ops", false, "", nil},
+		{"problems fail", []string{"--check-mentions", "fail"}, "@alice @carol @nobody ~ops ~nowhere", false, problems, nil},
+		{"problems warn", []string{"--check-mentions", "warn"}, "@alice @carol @nobody ~ops ~nowhere", false, "", nil},
+		{"off", []string{"--check-mentions", "off"}, "@nobody", true, "", nil},
+		{"add to channel", []string{"--check-mentions", "fail", "--add-mentioned-to-channel"}, "@alice @carol", false, "", []string{strings.Repeat("d", 26)}},
+		{"lookup fails warn", []string{"--check-mentions", "warn"}, "@alice", true, "", nil},
+		{"lookup fails fail", []string{"--check-mentions", "fail"}, "@alice", true, "api.context.500.app_error", nil},
+	} {
+		mentions := &mentionServer{broken: test.broken}
+		server := httptest.NewServer(mentions)
+
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("check-mentions", "warn", "")
+		cmd.Flags().Bool("add-mentioned-to-channel", false, "")
+		cmd.ParseFlags(test.args)
+
+		err := checkMentions(cmd, model.NewAPIv4Client(server.URL), channel, test.message)
+		server.Close()
+
+		if test.err == "" && err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: got %v, want %v", test.name, err, test.err)
+		}
+
+		if !reflect.DeepEqual(mentions.added, test.added) {
+			t.Errorf("%v: added %v, want %v", test.name, mentions.added, test.added)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+)
+
+// needsMfa reports whether a failed login failed because the account needs
+// an MFA token.
+func needsMfa(client *model.Client4, loginId string, resp *model.Response) bool {
+	switch resp.Error.Id {
+	case "api.user.check_user_mfa.bad_code.app_error",
+		"ent.mfa.validate_token.authenticate.app_error",
+		"mfa.validate_token.authenticate.app_error":
+		return true
+	}
+
+	if resp.StatusCode != 401 {
+		return false
+	}
+
+	required, checkResp := client.CheckUserMfa(loginId)
+	return checkResp.Error == nil && required
+}
+
+func promptMfaToken() (string, error) {
+	fmt.Print("MFA token: ")
+	token, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	token = strings.TrimSpace(token)
+	if token == "" {
+		if err != nil {
+			return "", fmt.Errorf("Need an MFA token: %v", err.Error())
+		}
+		return "", fmt.Errorf("Need an MFA token")
+	}
+
+	return token, nil
+}
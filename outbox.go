@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var flushCmd = &cobra.Command{
+	Use:   "flush [server]",
+	Short: "Deliver the posts saved to the outbox while the server was unreachable",
+	RunE:  doFlushCmdF,
+}
+
+func init() {
+	flushCmd.Flags().String("outbox", defaultOutboxDir(), "The outbox directory to deliver posts from")
+	flushCmd.Flags().Bool("wait", false, "Keep retrying with exponential backoff until the outbox is empty")
+	flushCmd.Flags().Duration("max-backoff", 10*time.Minute, "The longest time to wait between retries")
+
+	rootCmd.AddCommand(flushCmd)
+}
+
+// EXIT_SPOOLED is the exit code when posts were saved to the outbox instead of
+// delivered, the sysexits.h code for a temporary failure.
+const EXIT_SPOOLED = 75
+
+// errSpooled is returned when some posts were saved to the outbox, so scripts
+// can tell that they weren't delivered yet.
+var errSpooled = errors.New("Not everything was delivered, the rest is waiting in the outbox")
+
+// outboxEntry is a post that couldn't be delivered, saved in its own
+// directory in the outbox along with copies of its attachments. A reply to a
+// post that is still in the outbox names the root by its pending post ID, as
+// the root has no ID until it is delivered.
+type outboxEntry struct {
+	Server        string      `json:"server"`
+	Team          string      `json:"team"`
+	Channel       string      `json:"channel"`
+	Post          *model.Post `json:"post"`
+	RootPendingId string      `json:"root_pending_id,omitempty"`
+	Attachments   []string    `json:"attachments"`
+}
+
+// configDir is where the tool keeps its files between runs.
+func configDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".mattermost-poster")
+}
+
+func defaultOutboxDir() string {
+	return filepath.Join(configDir(), "outbox")
+}
+
+// spoolPost saves the post and copies of its attachments to a new entry in
+// the outbox. Entry names start with the time they were saved, so sorting
+// them gives the original posting order.
+func spoolPost(outbox string, server string, channel string, team string, post *model.Post, rootPendingId string, attachments []string) (string, error) {
+	name := fmt.Sprintf("%020d-%v", time.Now().UnixNano(), post.PendingPostId)
+	dir := filepath.Join(outbox, name)
+	tmpDir := filepath.Join(outbox, "."+name)
+
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return "", err
+	}
+
+	entry := &outboxEntry{
+		Server:        server,
+		Team:          team,
+		Channel:       channel,
+		Post:          post,
+		RootPendingId: rootPendingId,
+	}
+	entry.Post.FileIds = nil
+
+	for i, filename := range attachments {
+		fileDir := filepath.Join("files", strconv.Itoa(i))
+		if err := os.MkdirAll(filepath.Join(tmpDir, fileDir), 0700); err != nil {
+			return "", err
+		}
+
+		spooled := filepath.Join(fileDir, filepath.Base(filename))
+		if err := copyFile(filename, filepath.Join(tmpDir, spooled)); err != nil {
+			fmt.Print("Unable to copy file: " + filename)
+			fmt.Println(" Error: " + err.Error())
+			continue
+		}
+		entry.Attachments = append(entry.Attachments, spooled)
+	}
+
+	if err := writeOutboxEntry(tmpDir, entry); err != nil {
+		return "", err
+	}
+
+	// Only complete entries ever appear under their real name
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// readOutbox returns the directories of the outbox entries in posting order.
+func readOutbox(outbox string) ([]string, error) {
+	files, err := ioutil.ReadDir(outbox)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() && name[0] != '.' && name != "failed" {
+			dirs = append(dirs, filepath.Join(outbox, name))
+		}
+	}
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+func readOutboxEntry(dir string) (*outboxEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "post.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &outboxEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+
+	if entry.Post == nil {
+		return nil, fmt.Errorf("No post in %v", dir)
+	}
+
+	return entry, nil
+}
+
+// writeOutboxEntry saves the entry to its directory, replacing the old copy
+// in one step so a crash never leaves half of it behind.
+func writeOutboxEntry(dir string, entry *outboxEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := filepath.Join(dir, ".post.json")
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, filepath.Join(dir, "post.json"))
+}
+
+func doFlushCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	outbox, _ := cmd.Flags().GetString("outbox")
+	wait, _ := cmd.Flags().GetBool("wait")
+	maxBackoff, _ := cmd.Flags().GetDuration("max-backoff")
+
+	backoff := time.Second
+	for {
+		err := flushOutbox(cmd, args[0], outbox)
+		if err == nil || !wait || !isUnreachable(err) {
+			return err
+		}
+
+		fmt.Println("Server unreachable, retrying in " + backoff.String())
+		fmt.Println(" Error: " + err.Error())
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// flushOutbox delivers the entries for the server in order. It stops at the
+// first entry that can't be delivered because the server is unreachable, so
+// that later posts never overtake earlier ones. Entries the server refuses are
+// moved to the failed directory of the outbox. Once the root of a thread is
+// delivered, the entries of its replies are saved with its ID, so they go to
+// the thread even if a later flush delivers them.
+func flushOutbox(cmd *cobra.Command, server string, outbox string) error {
+	if _, err := os.Stat(outbox); os.IsNotExist(err) {
+		return nil
+	}
+
+	unlock, err := lockOutbox(outbox)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dirs, err := readOutbox(outbox)
+	if err != nil {
+		return err
+	}
+
+	var entries []*outboxEntry
+	var entryDirs []string
+	for _, dir := range dirs {
+		entry, err := readOutboxEntry(dir)
+		if err != nil {
+			fmt.Println("Unable to read outbox entry: " + dir)
+			fmt.Println(" Error: " + err.Error())
+			continue
+		}
+
+		if entry.Server == server {
+			entries = append(entries, entry)
+			entryDirs = append(entryDirs, dir)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	client, user, err := login(cmd, server)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		dir := entryDirs[i]
+
+		created, err := deliverOutboxEntry(client, user, dir, entry)
+		if err != nil && isUnreachable(err) {
+			return err
+		} else if err != nil {
+			fmt.Println("Unable to deliver post: " + dir)
+			fmt.Println(" Error: " + err.Error())
+
+			if err := os.MkdirAll(filepath.Join(outbox, "failed"), 0700); err != nil {
+				return err
+			}
+			if err := os.Rename(dir, filepath.Join(outbox, "failed", filepath.Base(dir))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for j, reply := range entries[i+1:] {
+			if reply.RootPendingId != "" && reply.RootPendingId == entry.Post.PendingPostId {
+				reply.Post.RootId = created.Id
+				reply.RootPendingId = ""
+				if err := writeOutboxEntry(entryDirs[i+1+j], reply); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		fmt.Println("Delivered: " + dir)
+
+		// Show other runs the lock is still in use
+		now := time.Now()
+		os.Chtimes(filepath.Join(outbox, ".lock"), now, now)
+	}
+
+	return nil
+}
+
+const (
+	// outboxLockWait is how long to wait for another run to finish flushing
+	outboxLockWait = 2 * time.Minute
+
+	// outboxLockStale is how old a lock has to be to be taken over, as the run
+	// that left it must have crashed
+	outboxLockStale = 10 * time.Minute
+)
+
+// lockOutbox takes the outbox lock, waiting for any other run that holds it,
+// so that two flushes at once, like the hooks of two quick commits, never
+// deliver the same posts twice. It returns the function that releases it.
+func lockOutbox(outbox string) (func(), error) {
+	lockFile := filepath.Join(outbox, ".lock")
+	deadline := time.Now().Add(outboxLockWait)
+
+	for {
+		file, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%v\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockFile) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockFile); err == nil && time.Since(info.ModTime()) > outboxLockStale {
+			fmt.Println("Removing stale outbox lock: " + lockFile)
+			os.Remove(lockFile)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("The outbox is still being flushed by another run, remove %v if it isn't", lockFile)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func deliverOutboxEntry(client *model.Client4, user *model.User, dir string, entry *outboxEntry) (*model.Post, error) {
+	// The root was refused, so the reply has no thread to go to
+	if entry.RootPendingId != "" {
+		return nil, fmt.Errorf("The first post of the thread wasn't delivered")
+	}
+
+	channel, err := lookupChannel(client, entry.Channel, entry.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []string
+	for _, attachment := range entry.Attachments {
+		attachments = append(attachments, filepath.Join(dir, attachment))
+	}
+
+	entry.Post.UserId = user.Id
+	entry.Post.ChannelId = channel.Id
+
+	return sendPost(client, entry.Post, attachments)
+}
+
+// gatewayTransport turns the gateway errors of a proxy in front of the server
+// into errors the client can read. Their bodies are usually HTML, which the
+// client would report as a plain server error without the status.
+type gatewayTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return resp, nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	appErr := model.NewAppError(req.URL.Path, "model.client.gateway.app_error", nil, req.URL.String()+": "+resp.Status, resp.StatusCode)
+	resp.Body = ioutil.NopCloser(strings.NewReader(appErr.ToJson()))
+	resp.ContentLength = -1
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+// testServer is a fake Mattermost server that records the posts it creates.
+// Channels named "missing" don't exist, and while down every request gets a
+// 503 from the proxy in front of it. With postsLeft set, it goes down once
+// that many posts have been created.
+type testServer struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	posts     []*model.Post
+	down      bool
+	postsLeft int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.down {
+		http.Error(w, "<html>Service Unavailable</html>", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/api/v4/users/me":
+		w.Write([]byte((&model.User{Id: "u" + strings.Repeat("0", 25), Username: "bot"}).ToJson()))
+	case r.URL.Path == "/api/v4/channels/missing":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(model.NewAppError("GetChannel", "store.sql_channel.get.existing.app_error", nil, "", http.StatusNotFound).ToJson()))
+	case strings.HasPrefix(r.URL.Path, "/api/v4/channels/"):
+		w.Write([]byte((&model.Channel{Id: strings.TrimPrefix(r.URL.Path, "/api/v4/channels/")}).ToJson()))
+	case r.URL.Path == "/api/v4/files":
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte((&model.FileUploadResponse{FileInfos: []*model.FileInfo{{Id: model.NewId()}}}).ToJson()))
+	case r.URL.Path == "/api/v4/posts":
+		post := model.PostFromJson(r.Body)
+		post.Id = model.NewId()
+		s.posts = append(s.posts, post)
+		if s.postsLeft != 0 {
+			s.postsLeft--
+			s.down = s.postsLeft == 0
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(post.ToJson()))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(model.NewAppError(r.URL.Path, "api.context.404.app_error", nil, "", http.StatusNotFound).ToJson()))
+	}
+}
+
+func (s *testServer) setDown(down bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.down = down
+}
+
+func (s *testServer) messages() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var messages []string
+	for _, post := range s.posts {
+		messages = append(messages, post.Message)
+	}
+	return messages
+}
+
+// newTestCmd returns a command with the flags postToTargets and flushOutbox
+// use, logging in with a token.
+func newTestCmd(t *testing.T, outbox string) *cobra.Command {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("token", "", "")
+	addPostingFlags(cmd)
+
+	if err := cmd.ParseFlags([]string{"--token", "secret", "--outbox", outbox, "--check-mentions", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestSpoolPost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outbox := filepath.Join(dir, "outbox")
+	attachment := filepath.Join(dir, "report.txt")
+	if err := ioutil.WriteFile(attachment, []byte("all good"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if dirs, err := readOutbox(outbox); err != nil || len(dirs) != 0 {
+		t.Fatalf("missing outbox: got %v, %v", dirs, err)
+	}
+
+	for _, message := range []string{"one", "two", "three"} {
+		var attachments []string
+		if message == "two" {
+			attachments = []string{attachment, filepath.Join(dir, "missing.txt")}
+		}
+
+		post := &model.Post{Message: message, PendingPostId: model.NewId(), FileIds: []string{"stale"}}
+		if _, err := spoolPost(outbox, "https://chat.example.com", "town-square", "eng", post, "", attachments); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Half written entries and failed posts are left alone
+	for _, skipped := range []string{".unfinished", "failed"} {
+		if err := os.MkdirAll(filepath.Join(outbox, skipped), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dirs, err := readOutbox(outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, dir := range dirs {
+		entry, err := readOutboxEntry(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, entry.Post.Message)
+
+		if entry.Server != "https://chat.example.com" || entry.Channel != "town-square" || entry.Team != "eng" {
+			t.Errorf("%v: got target %v %v %v", entry.Post.Message, entry.Server, entry.Team, entry.Channel)
+		}
+		if entry.Post.FileIds != nil {
+			t.Errorf("%v: file IDs were saved: %v", entry.Post.Message, entry.Post.FileIds)
+		}
+
+		if entry.Post.Message != "two" {
+			if len(entry.Attachments) != 0 {
+				t.Errorf("%v: got attachments %v", entry.Post.Message, entry.Attachments)
+			}
+			continue
+		}
+		if len(entry.Attachments) != 1 {
+			t.Fatalf("two: got attachments %v, want the one that exists", entry.Attachments)
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(dir, entry.Attachments[0])); err != nil || string(data) != "all good" {
+			t.Errorf("two: got attachment %q, %v", data, err)
+		}
+	}
+
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("got %v, want %v", messages, want)
+	}
+}
+
+func TestFlushOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newTestServer()
+	defer server.Close()
+
+	outbox := filepath.Join(dir, "outbox")
+	cmd := newTestCmd(t, outbox)
+
+	for _, post := range []struct {
+		server  string
+		channel string
+		message string
+	}{
+		{server.URL, "general", "first"},
+		{server.URL, "missing", "refused"},
+		{"https://other.example.com", "general", "elsewhere"},
+		{server.URL, "general", "second"},
+	} {
+		if _, err := spoolPost(outbox, post.server, post.channel, "", &model.Post{Message: post.message, PendingPostId: model.NewId()}, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is delivered or dropped while the server is down
+	server.setDown(true)
+	if err := flushOutbox(cmd, server.URL, outbox); !isUnreachable(err) {
+		t.Fatalf("down: got %v, want an unreachable error", err)
+	}
+	if dirs, _ := readOutbox(outbox); len(dirs) != 4 {
+		t.Fatalf("down: got %v entries, want 4", len(dirs))
+	}
+
+	server.setDown(false)
+	if err := flushOutbox(cmd, server.URL, outbox); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages, want := server.messages(), []string{"first", "second"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("got posts %v, want %v", messages, want)
+	}
+
+	dirs, _ := readOutbox(outbox)
+	if len(dirs) != 1 {
+		t.Fatalf("got %v entries left, want the other server's", len(dirs))
+	}
+	if entry, err := readOutboxEntry(dirs[0]); err != nil || entry.Post.Message != "elsewhere" {
+		t.Errorf("got entry %+v, %v left", entry, err)
+	}
+
+	failed, _ := readOutbox(filepath.Join(outbox, "failed"))
+	if len(failed) != 1 {
+		t.Fatalf("got %v failed entries, want 1", len(failed))
+	}
+	if entry, err := readOutboxEntry(failed[0]); err != nil || entry.Post.Message != "refused" {
+		t.Errorf("got failed entry %+v, %v", entry, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outbox, ".lock")); !os.IsNotExist(err) {
+		t.Errorf("the lock was left behind: %v", err)
+	}
+}
+
+func TestPostToTargetsSpools(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newTestServer()
+	defer server.Close()
+
+	outbox := filepath.Join(dir, "outbox")
+	cmd := newTestCmd(t, outbox)
+	targets := []*postTarget{{Server: server.URL, Channel: "general"}}
+
+	server.setDown(true)
+	if err := postToTargets(cmd, targets, time.Time{}, []*model.Post{{Message: "hello"}}, nil, false); err != errSpooled {
+		t.Fatalf("down: got %v, want errSpooled", err)
+	}
+
+	server.setDown(false)
+
+	// A post that fails for good isn't saved
+	if err := postToTargets(cmd, []*postTarget{{Server: server.URL, Channel: "missing"}}, time.Time{}, []*model.Post{{Message: "lost"}}, nil, false); err == nil || err == errSpooled {
+		t.Errorf("missing channel: got %v, want an error", err)
+	}
+
+	if err := postToTargets(cmd, targets, time.Time{}, []*model.Post{{Message: "hello again"}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if dirs, _ := readOutbox(outbox); len(dirs) != 1 {
+		t.Errorf("got %v entries, want 1", len(dirs))
+	}
+}
+
+func TestSpooledThread(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newTestServer()
+	defer server.Close()
+
+	outbox := filepath.Join(dir, "outbox")
+	cmd := newTestCmd(t, outbox)
+	thread := []*model.Post{{Message: "summary"}, {Message: "a.go"}, {Message: "b.go"}}
+
+	server.setDown(true)
+	if err := postToTargets(cmd, []*postTarget{{Server: server.URL, Channel: "general"}}, time.Time{}, thread, nil, true); err != errSpooled {
+		t.Fatalf("down: got %v, want errSpooled", err)
+	}
+	if err := postToTargets(cmd, []*postTarget{{Server: server.URL, Channel: "missing"}}, time.Time{}, thread, nil, true); err != errSpooled {
+		t.Fatalf("down: got %v, want errSpooled", err)
+	}
+
+	// The server goes down again after the root is delivered, so the replies
+	// have to find it on the next flush
+	server.mutex.Lock()
+	server.down = false
+	server.postsLeft = 1
+	server.mutex.Unlock()
+	if err := flushOutbox(cmd, server.URL, outbox); !isUnreachable(err) {
+		t.Fatalf("got %v, want an unreachable error", err)
+	}
+
+	server.setDown(false)
+	if err := flushOutbox(cmd, server.URL, outbox); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mutex.Lock()
+	posts := server.posts
+	server.mutex.Unlock()
+	if len(posts) != 3 {
+		t.Fatalf("got %v posts, want 3", len(posts))
+	}
+	for i, post := range posts {
+		if post.Message != thread[i].Message {
+			t.Errorf("post %v: got %q, want %q", i+1, post.Message, thread[i].Message)
+		}
+		if i != 0 && post.RootId != posts[0].Id {
+			t.Errorf("%v: got root %q, want %q", post.Message, post.RootId, posts[0].Id)
+		}
+	}
+
+	// The replies to a root that was refused are refused with it
+	if dirs, _ := readOutbox(outbox); len(dirs) != 0 {
+		t.Errorf("got %v entries left, want 0", len(dirs))
+	}
+	if failed, _ := readOutbox(filepath.Join(outbox, "failed")); len(failed) != 3 {
+		t.Errorf("got %v failed entries, want 3", len(failed))
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	connecting := func(detail string) error {
+		return model.NewAppError("https://chat.example.com/api/v4/users/login", "model.client.connecting.app_error", nil, detail, 0)
+	}
+
+	for _, test := range []struct {
+		name        string
+		err         error
+		unreachable bool
+	}{
+		{"connection refused", connecting(`Post "http://127.0.0.1:1/api/v4/users/login": dial tcp 127.0.0.1:1: connect: connection refused`), true},
+		{"dial timeout", connecting(`Post "https://10.255.255.1/api/v4/users/login": dial tcp 10.255.255.1:443: i/o timeout`), true},
+		{"unknown host", connecting(`Post "https://no-such-host.invalid/api/v4/users/login": dial tcp: lookup no-such-host.invalid: no such host`), false},
+		{"certificate", connecting(`Post "https://chat.example.com/api/v4/users/login": x509: certificate signed by unknown authority`), false},
+		{"response timeout", connecting(`Post "https://chat.example.com/api/v4/users/login": context deadline exceeded (Client.Timeout exceeded while awaiting headers)`), false},
+		{"bad gateway", model.NewAppError("", "model.client.gateway.app_error", nil, "", http.StatusBadGateway), true},
+		{"unavailable", model.NewAppError("", "api.context.unavailable.app_error", nil, "", http.StatusServiceUnavailable), true},
+		{"gateway timeout", model.NewAppError("", "model.client.gateway.app_error", nil, "", http.StatusGatewayTimeout), true},
+		{"server error", model.NewAppError("", "api.post.create_post.app_error", nil, "", http.StatusInternalServerError), false},
+		{"not implemented", model.NewAppError("", "api.context.501.app_error", nil, "", http.StatusNotImplemented), false},
+		{"not found", model.NewAppError("", "api.context.404.app_error", nil, "", http.StatusNotFound), false},
+		{"other error", errors.New("connection refused"), false},
+		{"no error", nil, false},
+	} {
+		if unreachable := isUnreachable(test.err); unreachable != test.unreachable {
+			t.Errorf("%v: got %v, want %v", test.name, unreachable, test.unreachable)
+		}
+	}
+}
+
+func TestGatewayTransport(t *testing.T) {
+	for _, test := range []struct {
+		status      int
+		contentType string
+		body        string
+		unreachable bool
+	}{
+		{http.StatusBadGateway, "text/html", "<html>Bad Gateway</html>", true},
+		{http.StatusGatewayTimeout, "", "", true},
+		{http.StatusServiceUnavailable, "application/json", `{"id":"api.context.unavailable.app_error","status_code":503}`, true},
+		{http.StatusInternalServerError, "text/html", "<html>Internal Server Error</html>", false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		client := model.NewAPIv4Client(server.URL)
+		client.HttpClient = &http.Client{Transport: &gatewayTransport{http.DefaultTransport}}
+
+		_, resp := client.GetMe("")
+		server.Close()
+
+		if resp.Error == nil {
+			t.Errorf("%v: got no error", test.status)
+			continue
+		}
+		if unreachable := isUnreachable(resp.Error); unreachable != test.unreachable {
+			t.Errorf("%v: got unreachable %v, want %v: %v", test.status, unreachable, test.unreachable, resp.Error)
+		}
+	}
+}
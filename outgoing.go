@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var serveOutgoingCmd = &cobra.Command{
+	Use:   "outgoing",
+	Short: "Answer Mattermost outgoing webhooks by running scripts",
+	Long: `Answer Mattermost outgoing webhooks by running scripts.
+
+Point outgoing webhooks at http://host:8080/. Each rule in the rules file maps a
+trigger word to a script, checked against the webhook's token. The script gets
+the message after the trigger word on stdin, and its output is the reply.`,
+	RunE: doServeOutgoingCmdF,
+}
+
+func init() {
+	serveOutgoingCmd.Flags().String("listen", ":8080", "Address to listen on")
+	serveOutgoingCmd.Flags().String("rules", "", "TOML file of trigger words and the scripts they run")
+	serveOutgoingCmd.Flags().Duration("script-timeout", 20*time.Second, "Time limit for scripts that don't set their own")
+	serveOutgoingCmd.Flags().Int("max-output", 3000, "The most script output in bytes to reply with")
+
+	serveCmd.AddCommand(serveOutgoingCmd)
+}
+
+// outgoingRules maps trigger words to scripts, like:
+//
+//	[[rule]]
+//	token = "9xuqwrwgstrb3mzrxb83nb357a"
+//	trigger = "deploy"
+//	command = ["scripts/deploy.sh", "--notify"]
+//	timeout = "2m"
+type outgoingRules struct {
+	Rules []*outgoingRule `toml:"rule"`
+}
+
+type outgoingRule struct {
+	Token        string   `toml:"token"`
+	Trigger      string   `toml:"trigger"`
+	Command      []string `toml:"command"`
+	Timeout      string   `toml:"timeout"`
+	ResponseType string   `toml:"response_type"`
+	Username     string   `toml:"username"`
+	IconURL      string   `toml:"icon_url"`
+	Markdown     bool     `toml:"markdown"`
+
+	timeout time.Duration
+}
+
+// outgoingServer answers the outgoing webhooks it receives.
+type outgoingServer struct {
+	rules     []*outgoingRule
+	maxOutput int
+}
+
+func doServeOutgoingCmdF(cmd *cobra.Command, args []string) error {
+	rulesFile, _ := cmd.Flags().GetString("rules")
+	scriptTimeout, _ := cmd.Flags().GetDuration("script-timeout")
+	maxOutput, _ := cmd.Flags().GetInt("max-output")
+
+	if len(args) > 0 {
+		return fmt.Errorf("Extra args")
+	}
+
+	if rulesFile == "" {
+		return fmt.Errorf("Need a rules file")
+	}
+
+	data, err := ioutil.ReadFile(rulesFile)
+	if err != nil {
+		return err
+	}
+
+	var parsed outgoingRules
+	if err := toml.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("Unable to read rules %v: %v", rulesFile, err.Error())
+	}
+
+	for i, rule := range parsed.Rules {
+		if rule.Token == "" {
+			return fmt.Errorf("Rule %v in %v has no token", i+1, rulesFile)
+		}
+		if rule.Trigger == "" {
+			return fmt.Errorf("Rule %v in %v has no trigger", i+1, rulesFile)
+		}
+		if len(rule.Command) == 0 {
+			return fmt.Errorf("Rule %v in %v has no command", i+1, rulesFile)
+		}
+		if rule.ResponseType != "" && rule.ResponseType != "comment" && rule.ResponseType != "post" {
+			return fmt.Errorf("Rule %v in %v has an invalid response_type, use comment or post", i+1, rulesFile)
+		}
+
+		rule.timeout = scriptTimeout
+		if rule.Timeout != "" {
+			if rule.timeout, err = time.ParseDuration(rule.Timeout); err != nil {
+				return fmt.Errorf("Invalid timeout in rule %v: %v", i+1, err.Error())
+			}
+		}
+	}
+
+	return listenAndServe(cmd, &outgoingServer{
+		rules:     parsed.Rules,
+		maxOutput: maxOutput,
+	})
+}
+
+// findRule returns the rule for the trigger word with the token.
+func (s *outgoingServer) findRule(token string, trigger string) *outgoingRule {
+	tokens := make([]string, len(s.rules))
+	for i, rule := range s.rules {
+		tokens[i] = rule.Token
+	}
+
+	for i, matched := range matchTokens(tokens, token) {
+		if matched && strings.EqualFold(s.rules[i].Trigger, trigger) {
+			return s.rules[i]
+		}
+	}
+	return nil
+}
+
+func (s *outgoingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := readOutgoingPayload(http.MaxBytesReader(w, r.Body, 1024*1024), r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Webhooks without trigger words send every message, so use its first word
+	trigger := payload.TriggerWord
+	if trigger == "" {
+		if fields := strings.Fields(payload.Text); len(fields) != 0 {
+			trigger = fields[0]
+		}
+	}
+
+	rule := s.findRule(payload.Token, trigger)
+	if rule == nil {
+		http.Error(w, "No rule for the token and trigger word", http.StatusUnauthorized)
+		return
+	}
+
+	input := strings.TrimSpace(payload.Text)
+	if len(input) >= len(trigger) && strings.EqualFold(input[:len(trigger)], trigger) {
+		input = strings.TrimSpace(input[len(trigger):])
+	}
+
+	env := []string{
+		"MM_TEXT=" + payload.Text,
+		"MM_TRIGGER_WORD=" + trigger,
+		"MM_USER_ID=" + payload.UserId,
+		"MM_USER_NAME=" + payload.UserName,
+		"MM_CHANNEL_ID=" + payload.ChannelId,
+		"MM_CHANNEL_NAME=" + payload.ChannelName,
+		"MM_TEAM_ID=" + payload.TeamId,
+		"MM_TEAM_DOMAIN=" + payload.TeamDomain,
+		"MM_POST_ID=" + payload.PostId,
+	}
+
+	output, err := runScript(rule.Command, input, env, rule.timeout, s.maxOutput)
+	if err != nil {
+		fmt.Println("Script " + rule.Command[0] + " for " + trigger + " failed")
+		fmt.Println(" Error: " + err.Error())
+	}
+
+	response := &model.CommandResponse{
+		ResponseType: rule.ResponseType,
+		Text:         scriptReply(output, err, rule.Markdown),
+		Username:     rule.Username,
+		IconURL:      rule.IconURL,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(response.ToJson()))
+}
+
+// readOutgoingPayload reads the webhook request, which Mattermost sends as
+// either a form or JSON depending on the webhook's content type.
+func readOutgoingPayload(body io.Reader, contentType string) (*model.OutgoingWebhookPayload, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &model.OutgoingWebhookPayload{}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		if err := json.Unmarshal(data, payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, err
+	}
+	payload.Token = form.Get("token")
+	payload.TeamId = form.Get("team_id")
+	payload.TeamDomain = form.Get("team_domain")
+	payload.ChannelId = form.Get("channel_id")
+	payload.ChannelName = form.Get("channel_name")
+	payload.UserId = form.Get("user_id")
+	payload.UserName = form.Get("user_name")
+	payload.PostId = form.Get("post_id")
+	payload.Text = form.Get("text")
+	payload.TriggerWord = form.Get("trigger_word")
+	return payload, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest, so
+// a noisy script can't use up the memory. It never keeps part of a character.
+type cappedBuffer struct {
+	buffer    bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buffer.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buffer.Write(p[:room])
+		}
+
+		// The cut may have split a character, possibly one that started in
+		// an earlier write
+		data := b.buffer.Bytes()
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					b.buffer.Truncate(i)
+				}
+				break
+			}
+		}
+		return len(p), nil
+	}
+	return b.buffer.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buffer.String()
+}
+
+// runScript runs the command with the input on stdin and the extra
+// environment, returning its combined output up to maxOutput bytes. The
+// command is killed when it runs longer than the timeout.
+func runScript(command []string, input string, env []string, timeout time.Duration, maxOutput int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	script := exec.CommandContext(ctx, command[0], command[1:]...)
+	script.Stdin = strings.NewReader(input)
+	script.Env = append(os.Environ(), env...)
+
+	output := &cappedBuffer{max: maxOutput}
+	script.Stdout = output
+	script.Stderr = output
+
+	// Don't wait forever for children that still hold the output open. The
+	// script itself has exited by then, so only its own exit status counts,
+	// even if the timeout passed while waiting
+	script.WaitDelay = time.Second
+
+	err := script.Run()
+	if ctx.Err() == context.DeadlineExceeded && (script.ProcessState == nil || !script.ProcessState.Exited()) {
+		err = fmt.Errorf("Timed out after %v", timeout)
+	} else if err == exec.ErrWaitDelay {
+		err = nil
+	}
+
+	text := output.String()
+	if output.truncated {
+		text = strings.TrimRight(text, "\n") + "\n…"
+	}
+	return text, err
+}
+
+// scriptReply formats the script output as a code block, or as it is when it
+// is Markdown, followed by why the script failed if it did.
+func scriptReply(output string, err error, markdown bool) string {
+	output = strings.TrimRight(stripAnsi(output), "\n")
+
+	reply := output
+	if !markdown && strings.TrimSpace(output) != "" {
+		reply = codeBlock(output, "")
+	}
+
+	if err != nil {
+		reply = strings.TrimSpace(reply + "\n\n**" + err.Error() + "**")
+	}
+	return reply
+}
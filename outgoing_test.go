@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		writes    []string
+		max       int
+		output    string
+		truncated bool
+	}{
+		{"fits", []string{"ab", "cd"}, 4, "abcd", false},
+		{"cut", []string{"abc", "def"}, 4, "abcd", true},
+		{"full", []string{"abcd", "e"}, 4, "abcd", true},
+		{"split character", []string{"ab", "é"}, 3, "ab", true},
+		{"split across writes", []string{"a", "\xe2\x82", "\xac!"}, 3, "a", true},
+		{"whole character", []string{"a€", "b"}, 4, "a€", true},
+		{"invalid output", []string{"\xff\xfe\xfd"}, 2, "\xff\xfe", true},
+	} {
+		buffer := &cappedBuffer{max: test.max}
+		for _, write := range test.writes {
+			if n, err := buffer.Write([]byte(write)); n != len(write) || err != nil {
+				t.Errorf("%v: write got %v, %v", test.name, n, err)
+			}
+		}
+
+		if output := buffer.String(); output != test.output || buffer.truncated != test.truncated {
+			t.Errorf("%v: got %q %v, want %q %v", test.name, output, buffer.truncated, test.output, test.truncated)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		command   []string
+		input     string
+		maxOutput int
+		output    string
+		err       string
+	}{
+		{"echo", []string{"sh", "-c", `echo "$GREETING $(cat)"`}, "world", 100, "hello world\n", ""},
+		{"fails", []string{"sh", "-c", "echo oops >&2; exit 3"}, "", 100, "oops\n", "exit status 3"},
+		{"timeout", []string{"sleep", "5"}, "", 100, "", "Timed out after 200ms"},
+		{"background child", []string{"sh", "-c", "sleep 5 & echo started"}, "", 100, "started\n", ""},
+		{"truncated", []string{"sh", "-c", "printf 'ab€€'"}, "", 4, "ab\n…", ""},
+	} {
+		output, err := runScript(test.command, test.input, []string{"GREETING=hello"}, 200*time.Millisecond, test.maxOutput)
+
+		if test.err == "" && err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: got %v, want %v", test.name, err, test.err)
+		}
+		if output != test.output || !utf8.ValidString(output) {
+			t.Errorf("%v: got %q, want %q", test.name, output, test.output)
+		}
+	}
+}
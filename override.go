@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+// setOverrideProps makes the post show the username and icon from the flags
+// instead of the account's own, the same way the server does for webhook
+// posts.
+func setOverrideProps(cmd *cobra.Command, post *model.Post) {
+	username, _ := cmd.Flags().GetString("as-username")
+	iconUrl, _ := cmd.Flags().GetString("icon-url")
+
+	if username == "" && iconUrl == "" {
+		return
+	}
+
+	if post.Props == nil {
+		post.Props = model.StringInterface{}
+	}
+
+	post.Props["from_webhook"] = "true"
+	if username != "" {
+		post.Props["override_username"] = username
+	}
+	if iconUrl != "" {
+		post.Props["override_icon_url"] = iconUrl
+	}
+}
+
+// warnDisabledOverrides warns when the post overrides the username or icon but
+// the server's client config says it won't show them.
+func warnDisabledOverrides(client *model.Client4, post *model.Post) {
+	_, hasUsername := post.Props["override_username"]
+	_, hasIcon := post.Props["override_icon_url"]
+	if !hasUsername && !hasIcon {
+		return
+	}
+
+	config, resp := client.GetOldClientConfig("")
+	if resp.Error != nil {
+		return
+	}
+
+	if hasUsername && config["EnablePostUsernameOverride"] != "true" {
+		fmt.Println("Warning: " + client.Url + " does not allow posts to override their username, it will not be shown")
+	}
+	if hasIcon && config["EnablePostIconOverride"] != "true" {
+		fmt.Println("Warning: " + client.Url + " does not allow posts to override their icon, it will not be shown")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var reactCmd = &cobra.Command{
+	Use:   "react [server] [post] [emoji]",
+	Short: "Add a reaction to a post",
+	RunE:  doReactCmdF,
+}
+
+var unreactCmd = &cobra.Command{
+	Use:   "unreact [server] [post] [emoji]",
+	Short: "Remove a reaction from a post",
+	RunE:  doUnreactCmdF,
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin [server] [post]",
+	Short: "Pin a post to its channel",
+	RunE:  doPinCmdF,
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin [server] [post]",
+	Short: "Unpin a post from its channel",
+	RunE:  doUnpinCmdF,
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete [server] [post]",
+	Short: "Delete a post",
+	RunE:  doDeleteCmdF,
+}
+
+func init() {
+	reactCmd.Flags().Bool("skip-emoji-check", false, "Don't check that the emoji exists (the built in emoji list is partial, so use this for rare ones)")
+
+	rootCmd.AddCommand(reactCmd, unreactCmd, pinCmd, unpinCmd, deleteCmd)
+}
+
+// parsePostId accepts either a post ID or a permalink to a post.
+func parsePostId(arg string) (string, error) {
+	postId := arg
+	if i := strings.LastIndex(arg, "/pl/"); i != -1 {
+		postId = arg[i+len("/pl/"):]
+		if end := strings.IndexAny(postId, "?#"); end != -1 {
+			postId = postId[:end]
+		}
+		postId = strings.Trim(postId, "/")
+	}
+
+	if !isValidId(postId) {
+		return "", fmt.Errorf("Invalid post ID or permalink: %v", arg)
+	}
+
+	return postId, nil
+}
+
+// postActionArgs checks the arguments of the post subcommands, logs in and
+// returns the post ID along with any remaining arguments.
+func postActionArgs(cmd *cobra.Command, args []string, extra int) (*model.Client4, *model.User, string, []string, error) {
+	if len(args) < 1 {
+		return nil, nil, "", nil, fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) < 2 {
+		return nil, nil, "", nil, fmt.Errorf("Need a post ID or permalink")
+	}
+
+	if len(args) < 2+extra {
+		return nil, nil, "", nil, fmt.Errorf("Missing args")
+	}
+
+	if len(args) > 2+extra {
+		return nil, nil, "", nil, fmt.Errorf("Extra args")
+	}
+
+	postId, err := parsePostId(args[1])
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	client, user, err := login(cmd, args[0])
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	return client, user, postId, args[2:], nil
+}
+
+func doReactCmdF(cmd *cobra.Command, args []string) error {
+	client, user, postId, rest, err := postActionArgs(cmd, args, 1)
+	if err != nil {
+		return err
+	}
+
+	emojiName := strings.Trim(rest[0], ":")
+
+	skipCheck, _ := cmd.Flags().GetBool("skip-emoji-check")
+	if !skipCheck {
+		if err := validateEmoji(client, emojiName); err != nil {
+			return err
+		}
+	}
+
+	if _, resp := client.SaveReaction(&model.Reaction{
+		UserId:    user.Id,
+		PostId:    postId,
+		EmojiName: emojiName,
+	}); resp.Error != nil {
+		return resp.Error
+	}
+
+	return nil
+}
+
+func doUnreactCmdF(cmd *cobra.Command, args []string) error {
+	client, user, postId, rest, err := postActionArgs(cmd, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if _, resp := client.DeleteReaction(&model.Reaction{
+		UserId:    user.Id,
+		PostId:    postId,
+		EmojiName: strings.Trim(rest[0], ":"),
+	}); resp.Error != nil {
+		return resp.Error
+	}
+
+	return nil
+}
+
+func doPinCmdF(cmd *cobra.Command, args []string) error {
+	client, _, postId, _, err := postActionArgs(cmd, args, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, resp := client.PinPost(postId); resp.Error != nil {
+		return resp.Error
+	}
+
+	return nil
+}
+
+func doUnpinCmdF(cmd *cobra.Command, args []string) error {
+	client, _, postId, _, err := postActionArgs(cmd, args, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, resp := client.UnpinPost(postId); resp.Error != nil {
+		return resp.Error
+	}
+
+	return nil
+}
+
+func doDeleteCmdF(cmd *cobra.Command, args []string) error {
+	client, _, postId, _, err := postActionArgs(cmd, args, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, resp := client.DeletePost(postId); resp.Error != nil {
+		return resp.Error
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParsePostId(t *testing.T) {
+	const id = "ifh6qs8nk7gzffr3xq5rwpmdxr"
+
+	for _, arg := range []string{
+		id,
+		"https://chat.example.com/team/pl/" + id,
+		"https://chat.example.com/team/pl/" + id + "/",
+		"https://chat.example.com/team/pl/" + id + "?utm_source=email",
+		"https://chat.example.com/team/pl/" + id + "#reply",
+		"https://chat.example.com/team/pl/" + id + "/?a=1#b",
+	} {
+		postId, err := parsePostId(arg)
+		if err != nil {
+			t.Errorf("%v: %v", arg, err)
+		} else if postId != id {
+			t.Errorf("%v: got %v, want %v", arg, postId, id)
+		}
+	}
+
+	for _, arg := range []string{
+		"",
+		"not-an-id",
+		"https://chat.example.com/team/pl/",
+		"https://chat.example.com/team/pl/?" + id,
+		"https://chat.example.com/team/pl/" + id + "x",
+	} {
+		if _, err := parsePostId(arg); err == nil {
+			t.Errorf("%q: got no error", arg)
+		}
+	}
+}
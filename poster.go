@@ -3,7 +3,13 @@ package main
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"fmt"
 
@@ -13,55 +19,377 @@ import (
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "mattermost-poster [server]",
+	Use:   "mattermost-poster",
 	Short: "Post messages with attachments to Mattermost",
+}
+
+var postCmd = &cobra.Command{
+	Use:   "post [server]",
+	Short: "Post a message with attachments to a channel",
 	RunE:  doPostCmdF,
 }
 
 func main() {
-	rootCmd.Flags().StringP("username", "u", "", "Username to login with")
-	rootCmd.Flags().StringP("password", "p", "", "Password to login with")
-	rootCmd.Flags().StringP("message", "m", "", "Text to send")
-	rootCmd.Flags().StringP("channel", "c", "", "The channel ID to send message to")
-	//rootCmd.Flags().StringP("fmessage", "f", "", "File to send as a message")
-	rootCmd.Flags().StringArrayP("attachment", "a", []string{}, "File to attach")
-
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.PersistentFlags().StringP("username", "u", "", "Username to login with")
+	rootCmd.PersistentFlags().StringP("password", "p", "", "Password to login with")
+	rootCmd.PersistentFlags().String("mfa-token", "", "Multi-factor authentication token to login with")
+	rootCmd.PersistentFlags().String("auth", "", "How to login: ldap, username (or email, the same login), id or token (default detected from the server)")
+	rootCmd.PersistentFlags().String("token", "", "Session or access token to use with --auth token")
+	rootCmd.PersistentFlags().StringArrayP("channel", "c", []string{}, "The channel ID or name to use, can be repeated when posting")
+	rootCmd.PersistentFlags().StringP("team", "t", "", "The team name used to look up channels by name")
+	rootCmd.PersistentFlags().Int("retries", 3, "How many times to retry failed requests")
+	rootCmd.PersistentFlags().Duration("retry-max-wait", time.Minute, "The longest time to wait before retrying a request")
+	rootCmd.PersistentFlags().String("ca-cert", "", "PEM file with extra CA certificates to trust")
+	rootCmd.PersistentFlags().String("client-cert", "", "PEM file with the client certificate for mutual TLS")
+	rootCmd.PersistentFlags().String("client-key", "", "PEM file with the client key for mutual TLS")
+	rootCmd.PersistentFlags().Bool("insecure-skip-verify", false, "Don't verify the server's TLS certificate (dangerous)")
+	rootCmd.PersistentFlags().String("proxy", "", "Proxy URL to connect through (default from HTTPS_PROXY/HTTP_PROXY)")
+	rootCmd.PersistentFlags().Duration("timeout", 30*time.Second, "Time limit for connecting and for each server response")
+
+	postCmd.Flags().StringP("message", "m", "", "Text to send, - for stdin")
+	postCmd.Flags().String("code", "", "File to send in a code block after the message, - for stdin")
+	postCmd.Flags().String("code-lang", "", "Language of the code block, detected from the file extension or shebang by default")
+	postCmd.Flags().Int("code-max-size", 3000, "Attach code longer than this many characters instead of posting it inline")
+	postCmd.Flags().String("ansi", "", "What to do with terminal escape codes in the message and code: strip, or render as Markdown emphasis and an HTML attachment")
+	postCmd.Flags().StringArrayP("attachment", "a", []string{}, "File to attach")
+	postCmd.Flags().String("at", "", "Wait until this time to post, like \"2026-10-20 09:00\"")
+	postCmd.Flags().Duration("in", 0, "Wait this long to post, like 2h")
+	addDeliveryFlags(postCmd)
+	postCmd.Flags().String("table", "", "CSV, TSV or JSON file to post as a table, - for stdin")
+	postCmd.Flags().String("table-format", "", "Format of the table: csv, tsv or json, detected from the file extension by default")
+	postCmd.Flags().String("columns", "", "Comma separated names or numbers of the table columns to show, in order")
+	postCmd.Flags().String("align", "", "Comma separated alignment of each table column: left, right or center. Numbers are right aligned by default")
+	postCmd.Flags().Int("decimals", -1, "Round numbers in the table to this many decimal places")
+	postCmd.Flags().Bool("thousands", false, "Group the thousands of numbers in the table with commas")
+	postCmd.Flags().Int("max-width", 0, "Cut table cells longer than this many characters")
+	postCmd.Flags().Bool("ci-card", false, "Attach a card describing the CI run, detected from GitHub Actions, GitLab CI, Jenkins, Drone or Buildkite")
+	postCmd.Flags().String("status", "", "Status of the CI run for the card color, like success, failure or cancelled")
+	postCmd.Flags().StringArray("junit", []string{}, "JUnit XML report to summarize and attach, can be a quoted glob like 'results/*.xml' and repeated")
+	postCmd.Flags().StringArray("tap", []string{}, "TAP report to summarize and attach, can be a quoted glob and repeated")
+	postCmd.Flags().Int("max-failures", 10, "The most failed tests to list from the reports")
+
+	rootCmd.AddCommand(postCmd)
+
+	// Calls without a subcommand are posts, as they were before subcommands existed.
+	if _, _, err := rootCmd.Find(os.Args[1:]); err != nil {
+		rootCmd.SetArgs(append([]string{"post"}, os.Args[1:]...))
+	}
+
+	if err := rootCmd.Execute(); err == errSpooled {
+		os.Exit(EXIT_SPOOLED)
+	} else if err != nil {
 		os.Exit(1)
 	}
 }
 
-func doPostCmdF(cmd *cobra.Command, args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("Need a server URL")
+// addDeliveryFlags adds the flags used by getPostTargets and postToTargets to
+// a command that posts.
+func addDeliveryFlags(cmd *cobra.Command) {
+	cmd.Flags().String("channel-file", "", "File with a channel ID or name on each line to post to")
+	cmd.Flags().String("profile", "", "TOML file of servers, teams and channels to post to")
+	cmd.Flags().Int("workers", 4, "How many posts to send at the same time")
+	addPostingFlags(cmd)
+}
+
+// addPostingFlags adds the flags postToTargets uses for each post to a command
+// that posts to channels it picks itself.
+func addPostingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("outbox", defaultOutboxDir(), "Directory to save posts to when the server is unreachable, empty to disable")
+	cmd.Flags().String("as-username", "", "Username to show on the post instead of the account's")
+	cmd.Flags().String("icon-url", "", "URL of the icon to show on the post instead of the account's picture")
+	cmd.Flags().String("check-mentions", "warn", "What to do about mentions of users who won't be notified: warn, fail or off")
+	cmd.Flags().Bool("add-mentioned-to-channel", false, "Add mentioned users to the channel when they aren't members")
+}
+
+// login connects to the server and logs in, reusing the session saved by the
+// login subcommand when no password or token was given.
+func login(cmd *cobra.Command, server string) (*model.Client4, *model.User, error) {
+	username, _ := cmd.Flags().GetString("username")
+	password, _ := cmd.Flags().GetString("password")
+	token, _ := cmd.Flags().GetString("token")
+
+	client, err := newClient(cmd, server)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if len(args) > 1 {
-		return fmt.Errorf("Extra args")
+	if password == "" && token == "" {
+		if user := loginWithSavedToken(client, server, username); user != nil {
+			return client, user, nil
+		}
+	}
+
+	user, err := createSession(cmd, client)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	return client, user, nil
+}
+
+// createSession logs in with the flags. The auth mode is detected from the
+// server when it isn't given. Credentials not given are read from ~/.netrc or
+// prompted for, as is an MFA token when the account needs one.
+func createSession(cmd *cobra.Command, client *model.Client4) (*model.User, error) {
 	username, _ := cmd.Flags().GetString("username")
 	password, _ := cmd.Flags().GetString("password")
-	message, _ := cmd.Flags().GetString("message")
-	channelId, _ := cmd.Flags().GetString("channel")
-	attachments, _ := cmd.Flags().GetStringArray("attachment")
+	mfaToken, _ := cmd.Flags().GetString("mfa-token")
+
+	auth, err := getAuthMode(cmd, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth == AUTH_TOKEN {
+		return loginWithToken(cmd, client)
+	}
+
+	if password == "" {
+		if serverUrl, err := url.Parse(client.Url); err == nil {
+			netrcLogin, netrcPassword := readNetrc(serverUrl.Hostname())
+			if netrcPassword != "" && (username == "" || username == netrcLogin) {
+				username, password = netrcLogin, netrcPassword
+			}
+		}
+	}
 
 	if password == "" {
 		fmt.Print("Password: ")
 		getpass, err := gopass.GetPasswd()
 		if err != nil {
-			return fmt.Errorf("Need a password")
+			return nil, fmt.Errorf("Need a password")
 		}
 		password = string(getpass)
+		// Remember the password for any later logins in this run
+		cmd.Flags().Set("password", password)
+	}
+
+	fields := loginFields(auth, username, password)
+	if mfaToken != "" {
+		fields["token"] = mfaToken
+	}
+
+	user, resp := loginRequest(client, fields)
+	if resp.Error != nil && mfaToken == "" && needsMfa(client, username, resp) {
+		if fields["token"], err = promptMfaToken(); err != nil {
+			return nil, err
+		}
+
+		user, resp = loginRequest(client, fields)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return user, nil
+}
+
+// newClient creates a client for the server that uses the TLS, proxy, timeout
+// and retry settings from the flags.
+func newClient(cmd *cobra.Command, server string) (*model.Client4, error) {
+	transport, err := newHTTPTransport(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	client := model.NewAPIv4Client(args[0])
+	client := model.NewAPIv4Client(server)
+	client.HttpClient = &http.Client{
+		Transport: &gatewayTransport{newRetryTransport(cmd, transport)},
+	}
+	return client, nil
+}
+
+// isValidId reports whether s looks like a Mattermost object ID.
+func isValidId(s string) bool {
+	return len(s) == 26 && model.IsValidAlphaNum(s)
+}
+
+// getChannel looks up the channel flag, either by ID or, when a team is
+// given, by name within that team.
+func getChannel(cmd *cobra.Command, client *model.Client4) (*model.Channel, error) {
+	channels, _ := cmd.Flags().GetStringArray("channel")
+	teamName, _ := cmd.Flags().GetString("team")
+
+	if len(channels) > 1 {
+		return nil, fmt.Errorf("Only one channel can be used with %v", cmd.Name())
+	}
+
+	channelArg := ""
+	if len(channels) == 1 {
+		channelArg = channels[0]
+	}
+
+	return lookupChannel(client, channelArg, teamName)
+}
+
+func lookupChannel(client *model.Client4, channelArg string, teamName string) (*model.Channel, error) {
+	if channelArg == "" {
+		return nil, fmt.Errorf("Need a channel")
+	}
+
+	if teamName == "" {
+		channel, resp := client.GetChannel(channelArg, "")
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return channel, nil
+	}
 
-	user, resp := client.Login(username, password)
+	channel, resp := client.GetChannelByNameForTeamName(channelArg, teamName, "")
 	if resp.Error != nil {
-		return resp.Error
+		return nil, resp.Error
+	}
+	return channel, nil
+}
+
+// getTeam looks up the team flag by name.
+func getTeam(cmd *cobra.Command, client *model.Client4) (*model.Team, error) {
+	teamName, _ := cmd.Flags().GetString("team")
+	if teamName == "" {
+		return nil, fmt.Errorf("Need a team")
+	}
+
+	team, resp := client.GetTeamByName(teamName, "")
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return team, nil
+}
+
+func doPostCmdF(cmd *cobra.Command, args []string) error {
+	profile, _ := cmd.Flags().GetString("profile")
+
+	if len(args) < 1 && profile == "" {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	message, _ := cmd.Flags().GetString("message")
+	attachments, _ := cmd.Flags().GetStringArray("attachment")
+	at, _ := cmd.Flags().GetString("at")
+	in, _ := cmd.Flags().GetDuration("in")
+
+	var postAt time.Time
+	if at != "" && in != 0 {
+		return fmt.Errorf("Only one of --at and --in can be used")
+	} else if at != "" {
+		var err error
+		if postAt, err = parseTime(at); err != nil {
+			return err
+		}
+		if postAt.Before(time.Now()) {
+			return fmt.Errorf("The --at time has already passed: %v", at)
+		}
+	} else if in != 0 {
+		postAt = time.Now().Add(in)
+	}
+
+	targets, err := getPostTargets(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	table, _ := cmd.Flags().GetString("table")
+	code, _ := cmd.Flags().GetString("code")
+	if table != "" && code != "" {
+		return fmt.Errorf("Only one of --table and --code can be used")
+	}
+
+	junit, _ := cmd.Flags().GetStringArray("junit")
+	tap, _ := cmd.Flags().GetStringArray("tap")
+
+	stdinReaders := 0
+	for _, arg := range append([]string{message, code, table}, append(junit, tap...)...) {
+		if arg == "-" {
+			stdinReaders++
+		}
+	}
+	if stdinReaders > 1 {
+		return fmt.Errorf("Only one of --message, --code, --table, --junit and --tap can read from stdin")
+	}
+
+	ansi, _ := cmd.Flags().GetString("ansi")
+	if ansi != "" && ansi != ANSI_STRIP && ansi != ANSI_RENDER {
+		return fmt.Errorf("Unknown --ansi mode: %v", ansi)
+	}
+
+	if message == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		message = strings.TrimRight(string(data), "\n")
+	}
+
+	switch ansi {
+	case ANSI_STRIP:
+		message = stripAnsi(message)
+	case ANSI_RENDER:
+		message = ansiToMarkdown(message)
+	}
+
+	defer removeTempAttachments()
+
+	if code != "" {
+		codeMessage, codeAttachments, err := renderCodeMessage(cmd, message)
+		if err != nil {
+			return err
+		}
+		message = codeMessage
+		attachments = append(attachments, codeAttachments...)
+	}
+
+	messages := []string{message}
+	if table != "" {
+		if messages, err = renderTableMessages(cmd, message); err != nil {
+			return err
+		}
+	}
+
+	var posts []*model.Post
+	for _, message := range messages {
+		post := &model.Post{
+			Message: message,
+			Type:    model.POST_DEFAULT,
+		}
+		setOverrideProps(cmd, post)
+		posts = append(posts, post)
+	}
+
+	if withCard, _ := cmd.Flags().GetBool("ci-card"); withCard {
+		status, _ := cmd.Flags().GetString("status")
+
+		info := detectCI()
+		if info == nil {
+			return fmt.Errorf("No CI environment detected for --ci-card")
+		}
+
+		card, err := ciCard(info, status)
+		if err != nil {
+			return err
+		}
+		addSlackAttachment(posts[0], card)
+	}
+
+	if len(junit) != 0 || len(tap) != 0 {
+		summary, reports, err := readTestReports(cmd)
+		if err != nil {
+			return err
+		}
+		addSlackAttachment(posts[0], summary)
+		attachments = append(attachments, reports...)
 	}
 
+	return postToTargets(cmd, targets, postAt, posts, attachments, false)
+}
+
+// sendPost uploads the attachments to the post's channel and creates the post
+// with them. Attachments that can't be read are reported and skipped, but a
+// failed upload fails the whole post.
+func sendPost(client *model.Client4, post *model.Post, attachments []string) (*model.Post, error) {
 	var fileIds []string
 	if len(attachments) != 0 {
 		for _, filename := range attachments {
@@ -79,24 +407,113 @@ func doPostCmdF(cmd *cobra.Command, args []string) error {
 			}
 			file.Close()
 
-			fileUploadResp, resp := client.UploadFile(data.Bytes(), channelId, filename)
-			if resp.Error != nil || fileUploadResp == nil || len(fileUploadResp.FileInfos) != 1 {
-				fmt.Print("Unable to upload file: " + filename)
-				fmt.Println(" Error: " + resp.Error.Error())
-				continue
+			fileUploadResp, resp := client.UploadFile(data.Bytes(), post.ChannelId, filepath.Base(filename))
+			if resp.Error != nil {
+				return nil, resp.Error
+			}
+			if fileUploadResp == nil || len(fileUploadResp.FileInfos) != 1 {
+				return nil, fmt.Errorf("Unable to upload file: %v", filename)
 			}
 
 			fileIds = append(fileIds, fileUploadResp.FileInfos[0].Id)
 		}
 	}
 
-	client.CreatePost(&model.Post{
-		UserId:    user.Id,
-		ChannelId: channelId,
-		Message:   message,
-		Type:      model.POST_DEFAULT,
-		FileIds:   fileIds,
-	})
+	post.FileIds = fileIds
+
+	created, resp := client.CreatePost(post)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return created, nil
+}
+
+// addSlackAttachment adds the attachment after any the post already has.
+func addSlackAttachment(post *model.Post, attachment *model.SlackAttachment) {
+	attachments, _ := post.Props["attachments"].([]*model.SlackAttachment)
+	post.AddProp("attachments", append(attachments, attachment))
+}
+
+var tempAttachmentDir string
+
+// tempAttachment writes generated content to a temporary file with the given
+// name, for attaching to a post.
+func tempAttachment(name string, data []byte) (string, error) {
+	if tempAttachmentDir == "" {
+		dir, err := ioutil.TempDir("", "mattermost-poster")
+		if err != nil {
+			return "", err
+		}
+		tempAttachmentDir = dir
+	}
+
+	// Each file gets its own directory so the names can repeat
+	dir, err := ioutil.TempDir(tempAttachmentDir, "")
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		return "", err
+	}
 
-	return nil
+	return filename, nil
+}
+
+// removeTempAttachments removes the files written by tempAttachment.
+func removeTempAttachments() {
+	if tempAttachmentDir != "" {
+		os.RemoveAll(tempAttachmentDir)
+		tempAttachmentDir = ""
+	}
+}
+
+// writeFileAtomic writes the file through a temporary file, so a crash never
+// leaves a half written file behind.
+func writeFileAtomic(filename string, data []byte) error {
+	if err := ioutil.WriteFile(filename+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// isUnreachable reports whether the error means the server is down for now,
+// like a refused or timed out connection or a gateway error from a proxy in
+// front of it. Errors that won't go away by waiting, like an unknown host or
+// any other server error, don't count.
+func isUnreachable(err error) bool {
+	appErr, ok := err.(*model.AppError)
+	if !ok {
+		return false
+	}
+
+	switch appErr.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	// The client only keeps the text of the connection error
+	if appErr.Id != "model.client.connecting.app_error" || !strings.Contains(appErr.DetailedError, "dial ") {
+		return false
+	}
+	return strings.Contains(appErr.DetailedError, "connection refused") || strings.Contains(appErr.DetailedError, "i/o timeout")
+}
+
+// parseTime parses a local date and time like "2026-10-20 09:00", or an
+// RFC 3339 timestamp.
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to parse time: %v", value)
+	}
+	return t, nil
 }
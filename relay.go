@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var serveRelayCmd = &cobra.Command{
+	Use:   "relay [server]",
+	Short: "Receive Slack compatible incoming webhooks and post them as a user",
+	Long: `Receive Slack compatible incoming webhooks and post them as a user.
+
+Each hook in the hooks file is served at /hooks/TOKEN and posts to its own
+channel. Requests take the same JSON as Mattermost incoming webhooks, as the
+body or in a payload form field. Multipart requests can include files to
+attach, and a root_id field posts the message as a reply. The response is "ok",
+or the post's ID as JSON with ?return_id=1.`,
+	RunE: doServeRelayCmdF,
+}
+
+func init() {
+	serveRelayCmd.Flags().String("listen", ":8066", "Address to listen on")
+	serveRelayCmd.Flags().String("hooks", "", "TOML file of hook tokens and the channels they post to")
+	serveRelayCmd.Flags().Int64("max-size", 50*1024*1024, "The largest request to accept in bytes, including files")
+
+	serveCmd.AddCommand(serveRelayCmd)
+}
+
+// relayHooks lists the hooks the relay serves, like:
+//
+//	[[hook]]
+//	token = "5f3b8c0d9e2a4b7c"
+//	team = "eng"
+//	channel = "builds"
+type relayHooks struct {
+	Hooks []*relayHook `toml:"hook"`
+}
+
+type relayHook struct {
+	Token   string `toml:"token"`
+	Team    string `toml:"team"`
+	Channel string `toml:"channel"`
+}
+
+var (
+	slackLinkRegexp      = regexp.MustCompile(`<((?:https?|mailto):[^|>]+)\|([^>]+)>`)
+	slackPlainLinkRegexp = regexp.MustCompile(`<((?:https?|mailto):[^|>]+)>`)
+)
+
+// relayServer posts the webhooks it receives.
+type relayServer struct {
+	session *serveSession
+	hooks   []*relayHook
+	maxSize int64
+}
+
+func doServeRelayCmdF(cmd *cobra.Command, args []string) error {
+	hooksFile, _ := cmd.Flags().GetString("hooks")
+	maxSize, _ := cmd.Flags().GetInt64("max-size")
+
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	if hooksFile == "" {
+		return fmt.Errorf("Need a hooks file")
+	}
+
+	data, err := ioutil.ReadFile(hooksFile)
+	if err != nil {
+		return err
+	}
+
+	var parsed relayHooks
+	if err := toml.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("Unable to read hooks %v: %v", hooksFile, err.Error())
+	}
+
+	for i, hook := range parsed.Hooks {
+		if len(hook.Token) < 16 {
+			return fmt.Errorf("Hook %v in %v needs a token of at least 16 characters", i+1, hooksFile)
+		}
+		if hook.Channel == "" {
+			return fmt.Errorf("Hook %v in %v has no channel", i+1, hooksFile)
+		}
+	}
+
+	session, err := newServeSession(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	return listenAndServe(cmd, &relayServer{
+		session: session,
+		hooks:   parsed.Hooks,
+		maxSize: maxSize,
+	})
+}
+
+// findHook returns the hook for the token.
+func (s *relayServer) findHook(token string) *relayHook {
+	tokens := make([]string, len(s.hooks))
+	for i, hook := range s.hooks {
+		tokens[i] = hook.Token
+	}
+
+	for i, matched := range matchTokens(tokens, token) {
+		if matched {
+			return s.hooks[i]
+		}
+	}
+	return nil
+}
+
+func (s *relayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/hooks/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	hook := s.findHook(strings.TrimPrefix(r.URL.Path, "/hooks/"))
+	if hook == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxSize)
+
+	tmpDir, err := ioutil.TempDir("", "mattermost-poster-relay")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	payload, attachments, err := readRelayRequest(r, tmpDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := model.IncomingWebhookRequestFromJson(bytes.NewReader(payload))
+	if request == nil {
+		http.Error(w, "Unable to parse the payload", http.StatusBadRequest)
+		return
+	}
+	if request.Text == "" && len(request.Attachments) == 0 && len(attachments) == 0 {
+		http.Error(w, "Nothing to post", http.StatusBadRequest)
+		return
+	}
+
+	// Replies aren't part of the incoming webhook format, so read them
+	// separately
+	var thread struct {
+		RootId string `json:"root_id"`
+	}
+	json.Unmarshal(payload, &thread)
+
+	channel, err := s.session.lookupChannel(hook.Channel, hook.Team)
+	if err != nil {
+		fmt.Println("Unable to find channel " + hook.Channel)
+		fmt.Println(" Error: " + err.Error())
+		http.Error(w, "Unable to find the channel", http.StatusInternalServerError)
+		return
+	}
+
+	post := relayPost(request)
+	post.ChannelId = channel.Id
+	post.RootId = thread.RootId
+
+	created, err := s.session.createPost(post, attachments)
+	if err != nil {
+		fmt.Println("Unable to relay post to " + hook.Channel)
+		fmt.Println(" Error: " + err.Error())
+
+		status := http.StatusBadGateway
+		if appErr, ok := err.(*model.AppError); ok && appErr.StatusCode >= 400 && appErr.StatusCode < 500 {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Incoming webhooks answer "ok", which some Slack clients check for, so
+	// the post ID is only returned when asked for
+	if r.URL.Query().Get("return_id") == "1" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": created.Id})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// readRelayRequest returns the JSON payload of the request, from the body or
+// a payload form field, and saves any uploaded files to the directory.
+func readRelayRequest(r *http.Request, dir string) ([]byte, []string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		return []byte(r.PostForm.Get("payload")), nil, nil
+	case "multipart/form-data":
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var payload []byte
+		var attachments []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+
+			if part.FileName() == "" {
+				if part.FormName() == "payload" {
+					if payload, err = ioutil.ReadAll(part); err != nil {
+						return nil, nil, err
+					}
+				}
+				continue
+			}
+
+			// Every file gets its own directory so names can repeat, and
+			// only the base name is used so they can't escape it
+			fileDir := filepath.Join(dir, fmt.Sprintf("%v", len(attachments)))
+			if err := os.Mkdir(fileDir, 0700); err != nil {
+				return nil, nil, err
+			}
+			filename := filepath.Join(fileDir, filepath.Base(part.FileName()))
+
+			file, err := os.Create(filename)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, err = io.Copy(file, part)
+			file.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			attachments = append(attachments, filename)
+		}
+
+		return payload, attachments, nil
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+	return payload, nil, err
+}
+
+// relayPost builds the post for the webhook, the way the server builds posts
+// for its own incoming webhooks.
+func relayPost(request *model.IncomingWebhookRequest) *model.Post {
+	post := &model.Post{
+		Message: slackToMarkdown(request.Text),
+		Type:    model.POST_DEFAULT,
+		Props:   model.StringInterface{},
+	}
+
+	for key, value := range request.Props {
+		post.Props[key] = value
+	}
+
+	post.Props["from_webhook"] = "true"
+	if request.Username != "" {
+		post.Props["override_username"] = request.Username
+	}
+	if request.IconURL != "" {
+		post.Props["override_icon_url"] = request.IconURL
+	}
+
+	if len(request.Attachments) != 0 {
+		for _, attachment := range request.Attachments {
+			attachment.Pretext = slackToMarkdown(attachment.Pretext)
+			attachment.Text = slackToMarkdown(attachment.Text)
+		}
+		post.Type = model.POST_SLACK_ATTACHMENT
+		post.Props["attachments"] = request.Attachments
+	}
+
+	return post
+}
+
+// slackToMarkdown turns Slack's <url|text> links into Markdown links.
+func slackToMarkdown(text string) string {
+	text = slackLinkRegexp.ReplaceAllString(text, "[$2]($1)")
+	return slackPlainLinkRegexp.ReplaceAllString(text, "$1")
+}
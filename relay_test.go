@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestMatchTokens(t *testing.T) {
+	tokens := []string{"5f3b8c0d9e2a4b7c", "0123456789abcdef", "5f3b8c0d9e2a4b7c"}
+
+	for _, test := range []struct {
+		token   string
+		matches []bool
+	}{
+		{"5f3b8c0d9e2a4b7c", []bool{true, false, true}},
+		{"0123456789abcdef", []bool{false, true, false}},
+		{"0123456789ABCDEF", []bool{false, false, false}},
+		{"0123456789abcde", []bool{false, false, false}},
+		{"0123456789abcdef0", []bool{false, false, false}},
+		{"", []bool{false, false, false}},
+	} {
+		if matches := matchTokens(tokens, test.token); !reflect.DeepEqual(matches, test.matches) {
+			t.Errorf("%q: got %v, want %v", test.token, matches, test.matches)
+		}
+	}
+}
+
+func TestFindHook(t *testing.T) {
+	server := &relayServer{hooks: []*relayHook{
+		{Token: "5f3b8c0d9e2a4b7c", Channel: "builds"},
+		{Token: "0123456789abcdef", Channel: "deploys"},
+	}}
+
+	for _, test := range []struct {
+		token   string
+		channel string
+	}{
+		{"5f3b8c0d9e2a4b7c", "builds"},
+		{"0123456789abcdef", "deploys"},
+		{"0123456789abcdeX", ""},
+		{"5f3b8c0d", ""},
+		{"", ""},
+	} {
+		channel := ""
+		if hook := server.findHook(test.token); hook != nil {
+			channel = hook.Channel
+		}
+		if channel != test.channel {
+			t.Errorf("%q: got %q, want %q", test.token, channel, test.channel)
+		}
+	}
+
+	// Unknown tokens are turned away before anything is read or posted
+	for _, path := range []string{"/hooks/0123456789abcdeX", "/hooks/", "/hooks", "/other/0123456789abcdef"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"text":"hi"}`)))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%v: got status %v, want %v", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestRelayPost(t *testing.T) {
+	request := model.IncomingWebhookRequestFromJson(strings.NewReader(`{
+		"text": "Deployed <https://ci.example.com/1|build 1> to <https://example.com>",
+		"username": "ci",
+		"icon_url": "https://example.com/ci.png",
+		"props": {"card": "details"},
+		"attachments": [{"pretext": "See <https://ci.example.com/1/log|the log>", "text": "done"}]
+	}`))
+	post := relayPost(request)
+
+	if want := "Deployed [build 1](https://ci.example.com/1) to https://example.com"; post.Message != want {
+		t.Errorf("got message %q, want %q", post.Message, want)
+	}
+	if post.Type != model.POST_SLACK_ATTACHMENT {
+		t.Errorf("got type %q, want %q", post.Type, model.POST_SLACK_ATTACHMENT)
+	}
+	for key, value := range map[string]string{
+		"from_webhook":      "true",
+		"override_username": "ci",
+		"override_icon_url": "https://example.com/ci.png",
+		"card":              "details",
+	} {
+		if post.Props[key] != value {
+			t.Errorf("got prop %v %v, want %v", key, post.Props[key], value)
+		}
+	}
+	if attachments := request.Attachments; attachments[0].Pretext != "See [the log](https://ci.example.com/1/log)" {
+		t.Errorf("got pretext %q", attachments[0].Pretext)
+	}
+}
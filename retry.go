@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// retryTransport retries requests that failed in ways that are likely to go
+// away by themselves: connection errors, server errors and rate limiting.
+// Requests that may have changed something on the server are only retried
+// when it is certain the server didn't act on them.
+type retryTransport struct {
+	transport http.RoundTripper
+	attempts  int
+	baseWait  time.Duration
+	maxWait   time.Duration
+}
+
+func newRetryTransport(cmd *cobra.Command, transport http.RoundTripper) *retryTransport {
+	attempts, _ := cmd.Flags().GetInt("retries")
+	maxWait, _ := cmd.Flags().GetDuration("retry-max-wait")
+
+	return &retryTransport{
+		transport: transport,
+		attempts:  attempts + 1,
+		baseWait:  500 * time.Millisecond,
+		maxWait:   maxWait,
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether the request failed before it reached the
+// server, which makes it safe to retry any request.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("Unable to retry request without a replayable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.transport.RoundTrip(req)
+
+		wait, retry := t.shouldRetry(req, resp, err)
+		if !retry || attempt >= t.attempts {
+			return resp, err
+		}
+
+		if wait == 0 {
+			wait = t.backoff(attempt)
+		}
+		if wait > t.maxWait {
+			wait = t.maxWait
+		}
+
+		// Notices go to stderr so they don't mix with output meant for other
+		// programs, like search --format json
+		if resp != nil {
+			fmt.Fprintf(os.Stderr, "Request to %v failed with %v, retrying in %v\n", req.URL.Path, resp.Status, wait)
+			resp.Body.Close()
+		} else {
+			fmt.Fprintf(os.Stderr, "Request to %v failed, retrying in %v\n", req.URL.Path, wait)
+			fmt.Fprintln(os.Stderr, " Error: "+err.Error())
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// shouldRetry decides whether to retry the request and, when the server said
+// how long to wait, for how long.
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		return 0, isDialError(err) || isIdempotent(req.Method)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// A rate limited request was never handled, so any method can be retried
+		return rateLimitWait(resp), true
+	}
+
+	if resp.StatusCode >= 500 && isIdempotent(req.Method) {
+		return rateLimitWait(resp), true
+	}
+
+	return 0, false
+}
+
+// rateLimitWait reads how long the server asked to wait from the Retry-After
+// or X-RateLimit-Reset headers.
+func rateLimitWait(resp *http.Response) time.Duration {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return at.Sub(time.Now())
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if seconds, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset")); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return 0
+}
+
+// backoff doubles the wait for each attempt and adds jitter, so that many
+// clients limited at the same time don't all retry at the same time.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	wait := t.baseWait << uint(attempt-1)
+	if wait <= 0 || wait > t.maxWait {
+		wait = t.maxWait
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		headers map[string]string
+		wait    time.Duration
+	}{
+		{"none", nil, 0},
+		{"retry after seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second},
+		{"retry after first", map[string]string{"Retry-After": "2", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "9"}, 2 * time.Second},
+		{"invalid retry after", map[string]string{"Retry-After": "soon"}, 0},
+		{"rate limit reset", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "3"}, 3 * time.Second},
+		{"requests remaining", map[string]string{"X-RateLimit-Remaining": "5", "X-RateLimit-Reset": "3"}, 0},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		for name, value := range test.headers {
+			resp.Header.Set(name, value)
+		}
+
+		if wait := rateLimitWait(resp); wait != test.wait {
+			t.Errorf("%v: got %v, want %v", test.name, wait, test.wait)
+		}
+	}
+
+	// Dates are relative to now
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if wait := rateLimitWait(resp); wait < 58*time.Second || wait > time.Minute {
+		t.Errorf("retry after date: got %v, want about a minute", wait)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := &retryTransport{baseWait: 100 * time.Millisecond, maxWait: time.Second}
+
+	for _, test := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			if wait := transport.backoff(test.attempt); wait < test.max/2 || wait > test.max {
+				t.Errorf("attempt %v: got %v, want between %v and %v", test.attempt, wait, test.max/2, test.max)
+			}
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		method   string
+		statuses []int
+		headers  map[string]string
+		attempts int
+		status   int
+	}{
+		{"success", "GET", []int{200}, nil, 1, 200},
+		{"server error", "GET", []int{500, 502, 200}, nil, 3, 200},
+		{"gives up", "GET", []int{503, 503, 503, 503}, nil, 3, 503},
+		{"not retried", "POST", []int{503, 200}, nil, 1, 503},
+		{"put retried", "PUT", []int{504, 200}, nil, 2, 200},
+		{"rate limited post", "POST", []int{429, 201}, map[string]string{"Retry-After": "0"}, 2, 201},
+		{"client error", "GET", []int{404, 200}, nil, 1, 404},
+	} {
+		var mutex sync.Mutex
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+
+			for name, value := range test.headers {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(test.statuses[len(bodies)-1])
+		}))
+
+		transport := &retryTransport{
+			transport: http.DefaultTransport,
+			attempts:  3,
+			baseWait:  time.Millisecond,
+			maxWait:   10 * time.Millisecond,
+		}
+
+		req, _ := http.NewRequest(test.method, server.URL, strings.NewReader("payload"))
+		resp, err := transport.RoundTrip(req)
+		server.Close()
+
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: got status %v, want %v", test.name, resp.StatusCode, test.status)
+		}
+		if len(bodies) != test.attempts {
+			t.Errorf("%v: got %v attempts, want %v", test.name, len(bodies), test.attempts)
+		}
+		for i, body := range bodies {
+			if body != "payload" {
+				t.Errorf("%v: attempt %v got body %q", test.name, i+1, body)
+			}
+		}
+	}
+}
+
+func TestRetryTransportDialError(t *testing.T) {
+	// A closed server refuses connections, and refused requests never reached
+	// it, so even a POST is tried again
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	attempts := 0
+	transport := &retryTransport{
+		transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+		attempts: 2,
+		baseWait: time.Millisecond,
+		maxWait:  time.Millisecond,
+	}
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	if _, err := transport.RoundTrip(req); err == nil || !isDialError(err) {
+		t.Errorf("got %v, want a dial error", err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %v attempts, want 2", attempts)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
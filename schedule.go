@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule [server]",
+	Short: "Run a daemon that posts messages from a crontab-like schedule file",
+	Long: `Run a daemon that posts messages from a crontab-like schedule file.
+
+Each line of the schedule file is either a cron entry or a one-shot post:
+
+    # minute hour day-of-month month day-of-week channel message
+    0 9 * * 1-5 town-square Standup in 5 minutes!
+    @at 2026-10-20 09:00 town-square Maintenance starts now
+
+Pending posts are saved to the state file so that posts missed while the
+daemon was down are made when it restarts. One-shot posts for a time that
+had already passed when they were added are skipped. Posts are delivered like
+the post command's, so posts that fail because the server is unreachable are
+saved to the outbox for the flush command.`,
+	RunE: doScheduleCmdF,
+}
+
+func init() {
+	scheduleCmd.Flags().StringP("file", "f", "", "The schedule file to read")
+	scheduleCmd.Flags().String("state", "", "The file to save pending posts to (default is the schedule file with .state appended)")
+	addPostingFlags(scheduleCmd)
+
+	rootCmd.AddCommand(scheduleCmd)
+}
+
+type scheduleJob struct {
+	Line     string    `json:"line"`
+	Channel  string    `json:"-"`
+	Message  string    `json:"-"`
+	Cron     *cronSpec `json:"-"`
+	NextRun  time.Time `json:"next_run"`
+	Finished bool      `json:"finished"`
+}
+
+func doScheduleCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	scheduleFile, _ := cmd.Flags().GetString("file")
+	stateFile, _ := cmd.Flags().GetString("state")
+	teamName, _ := cmd.Flags().GetString("team")
+
+	if scheduleFile == "" {
+		return fmt.Errorf("Need a schedule file")
+	}
+	if stateFile == "" {
+		stateFile = scheduleFile + ".state"
+	}
+
+	jobs, err := readSchedule(scheduleFile)
+	if err != nil {
+		return err
+	}
+
+	saved, err := readScheduleState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if state, ok := saved[job.Line]; ok {
+			job.NextRun = state.NextRun
+			job.Finished = state.Finished
+		} else if job.Cron != nil {
+			job.NextRun = job.Cron.next(now)
+			job.Finished = job.NextRun.IsZero()
+		} else if job.NextRun.Before(now) {
+			fmt.Println("Skipping post for a time that has already passed: " + job.Line)
+			job.Finished = true
+		}
+	}
+
+	if err := writeScheduleState(stateFile, jobs); err != nil {
+		return err
+	}
+
+	// Check the login now, rather than when the first job is due. A server
+	// that is down is fine, as posts go to the outbox until it is back.
+	if _, _, err := login(cmd, args[0]); err != nil {
+		if !isUnreachable(err) {
+			return err
+		}
+		fmt.Println("Unable to reach the server, will try again when posting")
+		fmt.Println(" Error: " + err.Error())
+	}
+
+	for {
+		now := time.Now()
+		next := now.Add(time.Minute)
+
+		for _, job := range jobs {
+			if job.Finished {
+				continue
+			}
+
+			if !job.NextRun.After(now) {
+				if now.Sub(job.NextRun) > time.Minute {
+					fmt.Println("Posting late, the post was due at " + job.NextRun.Format("2006-01-02 15:04") + ": " + job.Line)
+				}
+
+				// Posts saved to the outbox are done as far as the schedule goes
+				if err := postScheduleJob(cmd, args[0], teamName, job); err != nil && err != errSpooled {
+					fmt.Println("Unable to post: " + job.Line)
+					fmt.Println(" Error: " + err.Error())
+
+					// Without an outbox, jobs stay pending while the server is
+					// down, and are tried again in a minute
+					if isUnreachable(err) {
+						continue
+					}
+				}
+
+				if job.Cron != nil {
+					job.NextRun = job.Cron.next(now)
+					job.Finished = job.NextRun.IsZero()
+				} else {
+					job.Finished = true
+				}
+
+				if err := writeScheduleState(stateFile, jobs); err != nil {
+					return err
+				}
+			}
+
+			if !job.Finished && job.NextRun.Before(next) {
+				next = job.NextRun
+			}
+		}
+
+		time.Sleep(next.Sub(time.Now()))
+	}
+}
+
+// postScheduleJob posts the job's message the way the post command does, with
+// the outbox, mention check and overrides.
+func postScheduleJob(cmd *cobra.Command, server string, teamName string, job *scheduleJob) error {
+	post := &model.Post{
+		Message: job.Message,
+		Type:    model.POST_DEFAULT,
+	}
+	setOverrideProps(cmd, post)
+
+	targets := []*postTarget{{Server: server, Team: teamName, Channel: job.Channel}}
+	return postToTargets(cmd, targets, time.Time{}, []*model.Post{post}, nil, false)
+}
+
+func readSchedule(filename string) ([]*scheduleJob, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var jobs []*scheduleJob
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		job, err := parseScheduleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", filename, lineNum, err.Error())
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, scanner.Err()
+}
+
+func parseScheduleLine(line string) (*scheduleJob, error) {
+	job := &scheduleJob{Line: line}
+
+	if strings.HasPrefix(line, "@at ") {
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("Need a date, time, channel and message")
+		}
+
+		at, err := parseTime(fields[1] + " " + fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		job.NextRun = at
+		job.Channel = fields[3]
+		job.Message = fields[4]
+		return job, nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("Need five time fields, a channel and a message")
+	}
+
+	cron, err := parseCron(fields[:5])
+	if err != nil {
+		return nil, err
+	}
+
+	job.Cron = cron
+	job.Channel = fields[5]
+	// Keep the message spacing as written
+	message := line
+	for i := 0; i < 6; i++ {
+		message = strings.TrimLeft(message, " \t")
+		message = message[strings.IndexAny(message, " \t"):]
+	}
+	job.Message = strings.TrimSpace(message)
+	return job, nil
+}
+
+func readScheduleState(filename string) (map[string]*scheduleJob, error) {
+	saved := map[string]*scheduleJob{}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return saved, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var jobs []*scheduleJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("Unable to read state file %v: %v", filename, err.Error())
+	}
+
+	for _, job := range jobs {
+		saved[job.Line] = job
+	}
+
+	return saved, nil
+}
+
+// writeScheduleState saves the jobs to the state file.
+func writeScheduleState(filename string, jobs []*scheduleJob) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filename, data)
+}
+
+// cronSpec holds the allowed values of the five crontab time fields.
+type cronSpec struct {
+	minute     map[int]bool
+	hour       map[int]bool
+	dayOfMonth map[int]bool
+	month      map[int]bool
+	dayOfWeek  map[int]bool
+
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func parseCron(fields []string) (*cronSpec, error) {
+	var err error
+	spec := &cronSpec{
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+
+	if spec.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if spec.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if spec.dayOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if spec.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if spec.dayOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Both 0 and 7 are Sunday
+	if spec.dayOfWeek[7] {
+		spec.dayOfWeek[0] = true
+	}
+
+	return spec, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges like 1-5 and
+// steps like */15 or 0-30/10.
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("Invalid step in cron field: %v", field)
+			}
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("Invalid cron field: %v", field)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("Invalid cron field: %v", field)
+				}
+			} else if step != 1 {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("Cron field out of range: %v", field)
+		}
+
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+
+	// Like cron, when both day fields are restricted either one may match
+	dayOfMonth := c.dayOfMonth[t.Day()]
+	dayOfWeek := c.dayOfWeek[int(t.Weekday())]
+	if c.anyDayOfMonth || c.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// next returns the first time after t that matches the schedule, or the zero
+// time if nothing matches within the next five years.
+func (c *cronSpec) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.matches(t) {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+
+	return time.Time{}
+}
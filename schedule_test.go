@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	for _, test := range []struct {
+		field  string
+		min    int
+		max    int
+		values []int
+	}{
+		{"*", 1, 5, []int{1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1,3,5", 0, 59, []int{1, 3, 5}},
+		{"1-4", 0, 59, []int{1, 2, 3, 4}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"0-30/10", 0, 59, []int{0, 10, 20, 30}},
+		{"50/5", 0, 59, []int{50, 55}},
+		{"1-2,20", 0, 59, []int{1, 2, 20}},
+	} {
+		values, err := parseCronField(test.field, test.min, test.max)
+		if err != nil {
+			t.Errorf("%v: %v", test.field, err)
+			continue
+		}
+
+		want := map[int]bool{}
+		for _, v := range test.values {
+			want[v] = true
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("%v: got %v, want %v", test.field, values, want)
+		}
+	}
+
+	for _, field := range []string{"", "x", "60", "5-1", "1-x", "*/0", "*/x", "-1", "1-60"} {
+		if _, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("%v: got no error", field)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2017, time.March, 15, 10, 30, 45, 0, time.UTC)
+
+	for _, test := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 15, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2017, time.March, 16, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2017, time.March, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2017, time.March, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2017, time.March, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+
+		// Either day field may match when both are restricted
+		{"0 0 20 * 5", time.Date(2017, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * 0", time.Date(2017, time.March, 16, 0, 0, 0, 0, time.UTC)},
+
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		spec, err := parseCron(strings.Fields(test.spec))
+		if err != nil {
+			t.Errorf("%v: %v", test.spec, err)
+			continue
+		}
+
+		if next := spec.next(from); !next.Equal(test.next) {
+			t.Errorf("%v: got %v, want %v", test.spec, next, test.next)
+		}
+	}
+
+	for _, line := range []string{"60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8"} {
+		if _, err := parseCron(strings.Fields(line)); err == nil {
+			t.Errorf("%v: got no error", line)
+		}
+	}
+}
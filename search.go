@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [server] [terms]",
+	Short: "Search posts in a team",
+	RunE:  doSearchCmdF,
+}
+
+func init() {
+	searchCmd.Flags().String("from", "", "Only find posts from this username")
+	searchCmd.Flags().String("in", "", "Only find posts in this channel name")
+	searchCmd.Flags().String("before", "", "Only find posts before this date (YYYY-MM-DD)")
+	searchCmd.Flags().String("after", "", "Only find posts after this date (YYYY-MM-DD)")
+	searchCmd.Flags().Bool("or", false, "Match posts containing any of the terms instead of all of them")
+	searchCmd.Flags().StringP("format", "f", "table", "Output format: table, json or context")
+	searchCmd.Flags().IntP("limit", "n", 20, "Maximum number of results to show")
+	searchCmd.Flags().String("then-reply", "", "Reply to the top hit with this message")
+
+	rootCmd.AddCommand(searchCmd)
+}
+
+func doSearchCmdF(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	from, _ := cmd.Flags().GetString("from")
+	in, _ := cmd.Flags().GetString("in")
+	before, _ := cmd.Flags().GetString("before")
+	after, _ := cmd.Flags().GetString("after")
+	isOrSearch, _ := cmd.Flags().GetBool("or")
+	format, _ := cmd.Flags().GetString("format")
+	limit, _ := cmd.Flags().GetInt("limit")
+	reply, _ := cmd.Flags().GetString("then-reply")
+
+	if format != "table" && format != "json" && format != "context" {
+		return fmt.Errorf("Unknown format: %v", format)
+	}
+
+	words := args[1:]
+	terms := strings.Join(words, " ")
+	if from != "" {
+		terms += " from:" + strings.TrimPrefix(from, "@")
+	}
+	if in != "" {
+		terms += " in:" + strings.TrimPrefix(in, "~")
+	}
+	if before != "" {
+		terms += " before:" + before
+	}
+	if after != "" {
+		terms += " after:" + after
+	}
+	terms = strings.TrimSpace(terms)
+	if terms == "" {
+		return fmt.Errorf("Need search terms")
+	}
+
+	client, user, err := login(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	team, err := getTeam(cmd, client)
+	if err != nil {
+		return err
+	}
+
+	postList, resp := client.SearchPosts(team.Id, terms, isOrSearch)
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	var posts []*model.Post
+	for _, id := range postList.Order {
+		if post, ok := postList.Posts[id]; ok {
+			posts = append(posts, post)
+		}
+		if limit > 0 && len(posts) == limit {
+			break
+		}
+	}
+
+	switch format {
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(posts); err != nil {
+			return err
+		}
+	case "context":
+		printSearchContext(client, team, posts, words)
+	default:
+		printSearchTable(client, team, posts)
+	}
+
+	if reply != "" {
+		if len(posts) == 0 {
+			return fmt.Errorf("No posts found to reply to")
+		}
+
+		top := posts[0]
+		rootId := top.RootId
+		if rootId == "" {
+			rootId = top.Id
+		}
+
+		if _, resp := client.CreatePost(&model.Post{
+			UserId:    user.Id,
+			ChannelId: top.ChannelId,
+			RootId:    rootId,
+			Message:   reply,
+			Type:      model.POST_DEFAULT,
+		}); resp.Error != nil {
+			return resp.Error
+		}
+	}
+
+	return nil
+}
+
+func permalink(client *model.Client4, team *model.Team, postId string) string {
+	return client.Url + "/" + team.Name + "/pl/" + postId
+}
+
+// getUsernames maps the user IDs of the posts to usernames, leaving the IDs
+// as they are if the lookup fails.
+func getUsernames(client *model.Client4, posts []*model.Post) map[string]string {
+	usernames := map[string]string{}
+	var userIds []string
+	for _, post := range posts {
+		if _, ok := usernames[post.UserId]; !ok {
+			usernames[post.UserId] = post.UserId
+			userIds = append(userIds, post.UserId)
+		}
+	}
+
+	if len(userIds) == 0 {
+		return usernames
+	}
+
+	users, resp := client.GetUsersByIds(userIds)
+	if resp.Error != nil {
+		return usernames
+	}
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+
+	return usernames
+}
+
+func printSearchTable(client *model.Client4, team *model.Team, posts []*model.Post) {
+	usernames := getUsernames(client, posts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tMESSAGE\tPERMALINK")
+	for _, post := range posts {
+		message := strings.Replace(post.Message, "\n", " ", -1)
+		if runes := []rune(message); len(runes) > 60 {
+			message = string(runes[:57]) + "..."
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", formatMillis(post.CreateAt), usernames[post.UserId], message, permalink(client, team, post.Id))
+	}
+	w.Flush()
+}
+
+func printSearchContext(client *model.Client4, team *model.Team, posts []*model.Post, words []string) {
+	usernames := getUsernames(client, posts)
+
+	var quoted []string
+	for _, word := range words {
+		word = strings.Trim(word, "\"*")
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+
+	var highlight *regexp.Regexp
+	if len(quoted) != 0 {
+		highlight = regexp.MustCompile("(?i)(" + strings.Join(quoted, "|") + ")")
+	}
+
+	for _, post := range posts {
+		fmt.Printf("%v @%v %v\n", formatMillis(post.CreateAt), usernames[post.UserId], permalink(client, team, post.Id))
+		message := post.Message
+		if highlight != nil {
+			message = highlight.ReplaceAllString(message, "\x1b[1;33m$1\x1b[0m")
+		}
+		for _, line := range strings.Split(message, "\n") {
+			fmt.Println("    " + line)
+		}
+		fmt.Println()
+	}
+}
+
+func formatMillis(millis int64) string {
+	return time.Unix(0, millis*int64(time.Millisecond)).Format("2006-01-02 15:04")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a server that posts what it receives",
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serveSession is the login a server mode posts with. It logs in again when
+// the session expires, as servers run for longer than sessions last, and
+// caches channel lookups.
+type serveSession struct {
+	cmd    *cobra.Command
+	server string
+
+	mutex    sync.Mutex
+	client   *model.Client4
+	user     *model.User
+	channels map[string]*model.Channel
+}
+
+func newServeSession(cmd *cobra.Command, server string) (*serveSession, error) {
+	client, user, err := login(cmd, server)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serveSession{
+		cmd:      cmd,
+		server:   server,
+		client:   client,
+		user:     user,
+		channels: map[string]*model.Channel{},
+	}, nil
+}
+
+// isUnauthorized reports whether the server refused the request because the
+// session is no longer valid.
+func isUnauthorized(err error) bool {
+	appErr, ok := err.(*model.AppError)
+	return ok && appErr.StatusCode == http.StatusUnauthorized
+}
+
+// do runs the request with the client, logging in again and retrying once if
+// the session has expired.
+func (s *serveSession) do(request func(client *model.Client4, user *model.User) error) error {
+	s.mutex.Lock()
+	client, user := s.client, s.user
+	s.mutex.Unlock()
+
+	err := request(client, user)
+	if !isUnauthorized(err) {
+		return err
+	}
+
+	s.mutex.Lock()
+	if s.client == client {
+		fmt.Println("Session expired, logging in again")
+		newClient, newUser, err := login(s.cmd, s.server)
+		if err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+		s.client, s.user = newClient, newUser
+	}
+	client, user = s.client, s.user
+	s.mutex.Unlock()
+
+	return request(client, user)
+}
+
+// lookupChannel finds the channel by ID, or by name in the team, remembering
+// it for next time.
+func (s *serveSession) lookupChannel(channelArg string, teamName string) (*model.Channel, error) {
+	key := teamName + "/" + channelArg
+
+	s.mutex.Lock()
+	channel := s.channels[key]
+	s.mutex.Unlock()
+	if channel != nil {
+		return channel, nil
+	}
+
+	err := s.do(func(client *model.Client4, user *model.User) error {
+		var err error
+		channel, err = lookupChannel(client, channelArg, teamName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.channels[key] = channel
+	s.mutex.Unlock()
+
+	return channel, nil
+}
+
+// createPost creates the post as the logged in user with the attachments.
+func (s *serveSession) createPost(post *model.Post, attachments []string) (*model.Post, error) {
+	var created *model.Post
+	err := s.do(func(client *model.Client4, user *model.User) error {
+		post.UserId = user.Id
+		var err error
+		created, err = sendPost(client, post, attachments)
+		return err
+	})
+	return created, err
+}
+
+// patchPost changes the parts of the post set in the patch.
+func (s *serveSession) patchPost(postId string, patch *model.PostPatch) (*model.Post, error) {
+	var patched *model.Post
+	err := s.do(func(client *model.Client4, user *model.User) error {
+		var resp *model.Response
+		if patched, resp = client.PatchPost(postId, patch); resp.Error != nil {
+			return resp.Error
+		}
+		return nil
+	})
+	return patched, err
+}
+
+// listenAndServe serves the handler on the address from the listen flag.
+func listenAndServe(cmd *cobra.Command, handler http.Handler) error {
+	listen, _ := cmd.Flags().GetString("listen")
+
+	fmt.Println("Listening on " + listen)
+	return http.ListenAndServe(listen, handler)
+}
+
+// checkBearerToken reports whether the request has the secret as a bearer
+// token or basic auth password. An empty secret allows no requests.
+func checkBearerToken(r *http.Request, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	if _, password, ok := r.BasicAuth(); ok {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+	}
+
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	return len(auth) > len(prefix) && subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(secret)) == 1
+}
+
+// matchTokens reports which of the tokens equal the given one. Every token is
+// compared, in constant time, so the tokens can't be guessed from response
+// times.
+func matchTokens(tokens []string, token string) []bool {
+	matches := make([]bool, len(tokens))
+	for i, expected := range tokens {
+		matches[i] = subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+	}
+	return matches
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ALIGN_LEFT   = "left"
+	ALIGN_RIGHT  = "right"
+	ALIGN_CENTER = "center"
+)
+
+// table is tabular data read from a CSV, TSV or JSON file.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// readTable reads the table from the file, or from stdin when the filename is
+// "-". The format is detected from the file extension when it isn't given.
+func readTable(filename string, format string) (*table, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".tsv", ".tab":
+			format = "tsv"
+		case ".json":
+			format = "json"
+		default:
+			format = "csv"
+		}
+	}
+
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "csv":
+		return readDelimitedTable(data, ',')
+	case "tsv":
+		return readDelimitedTable(data, '\t')
+	case "json":
+		return readJsonTable(data)
+	}
+
+	return nil, fmt.Errorf("Unknown table format: %v", format)
+}
+
+// readDelimitedTable reads CSV or TSV data, taking the first row as the
+// header.
+func readDelimitedTable(data []byte, comma rune) (*table, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = comma == '\t'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read table: %v", err.Error())
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("Table is empty")
+	}
+
+	return &table{header: records[0], rows: records[1:]}, nil
+}
+
+// readJsonTable reads a JSON array of objects, with a column for each key in
+// the order they first appear, or a JSON array of arrays with the header
+// first.
+func readJsonTable(data []byte) (*table, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("Unable to read table: need a JSON array: %v", err.Error())
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Table is empty")
+	}
+
+	if trimmed := bytes.TrimSpace(items[0]); len(trimmed) != 0 && trimmed[0] == '[' {
+		var records [][]json.RawMessage
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("Unable to read table: %v", err.Error())
+		}
+
+		t := &table{}
+		for i, record := range records {
+			row := make([]string, len(record))
+			for j, value := range record {
+				row[j] = jsonCell(value)
+			}
+			if i == 0 {
+				t.header = row
+			} else {
+				t.rows = append(t.rows, row)
+			}
+		}
+		return t, nil
+	}
+
+	t := &table{}
+	columns := map[string]int{}
+	var objects []map[string]json.RawMessage
+	for _, item := range items {
+		// Decoding to a map loses the key order, so read the keys one at a time
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+			return nil, fmt.Errorf("Unable to read table: need a JSON array of objects or arrays")
+		}
+
+		object := map[string]json.RawMessage{}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read table: %v", err.Error())
+			}
+			key := token.(string)
+
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, fmt.Errorf("Unable to read table: %v", err.Error())
+			}
+
+			if _, ok := columns[key]; !ok {
+				columns[key] = len(t.header)
+				t.header = append(t.header, key)
+			}
+			object[key] = value
+		}
+		objects = append(objects, object)
+	}
+
+	for _, object := range objects {
+		row := make([]string, len(t.header))
+		for key, value := range object {
+			row[columns[key]] = jsonCell(value)
+		}
+		t.rows = append(t.rows, row)
+	}
+
+	return t, nil
+}
+
+// jsonCell turns a JSON value into cell text. Strings lose their quotes,
+// nulls are empty and anything else is shown as JSON.
+func jsonCell(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+
+	trimmed := string(bytes.TrimSpace(value))
+	if trimmed == "null" {
+		return ""
+	}
+	return trimmed
+}
+
+// selectColumns keeps only the given columns, in the given order. Columns are
+// header names or numbers starting from 1.
+func (t *table) selectColumns(columns []string) error {
+	var indexes []int
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+
+		index := -1
+		for i, name := range t.header {
+			if name == column {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			if n, err := strconv.Atoi(column); err == nil && n >= 1 && n <= len(t.header) {
+				index = n - 1
+			}
+		}
+		if index == -1 {
+			return fmt.Errorf("No column %v in the table", column)
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	pick := func(row []string) []string {
+		picked := make([]string, len(indexes))
+		for i, index := range indexes {
+			if index < len(row) {
+				picked[i] = row[index]
+			}
+		}
+		return picked
+	}
+
+	t.header = pick(t.header)
+	for i, row := range t.rows {
+		t.rows[i] = pick(row)
+	}
+
+	return nil
+}
+
+// isNumericColumn reports whether every non-empty cell in the column is a
+// number.
+func (t *table) isNumericColumn(column int) bool {
+	numeric := false
+	for _, row := range t.rows {
+		if column >= len(row) || strings.TrimSpace(row[column]) == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(row[column]), 64); err != nil {
+			return false
+		}
+		numeric = true
+	}
+	return numeric
+}
+
+// formatNumber rounds the number to the given decimals, unless decimals is
+// negative, and groups the thousands with commas.
+func formatNumber(cell string, decimals int, thousands bool) string {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return cell
+	}
+
+	if decimals >= 0 {
+		if f, err := strconv.ParseFloat(cell, 64); err == nil {
+			cell = strconv.FormatFloat(f, 'f', decimals, 64)
+		}
+	}
+
+	if !thousands || strings.ContainsAny(cell, "eE") {
+		return cell
+	}
+
+	sign := ""
+	if strings.HasPrefix(cell, "-") || strings.HasPrefix(cell, "+") {
+		sign, cell = cell[:1], cell[1:]
+	}
+
+	integer, fraction := cell, ""
+	if dot := strings.Index(cell, "."); dot != -1 {
+		integer, fraction = cell[:dot], cell[dot:]
+	}
+
+	var grouped []string
+	for len(integer) > 3 {
+		grouped = append([]string{integer[len(integer)-3:]}, grouped...)
+		integer = integer[:len(integer)-3]
+	}
+	grouped = append([]string{integer}, grouped...)
+
+	return sign + strings.Join(grouped, ",") + fraction
+}
+
+// markdownCell makes the cell safe to put in a Markdown table row, and cuts it
+// to the maximum width when there is one.
+func markdownCell(cell string, maxWidth int) string {
+	cell = strings.Replace(cell, "\r\n", " ", -1)
+	cell = strings.Replace(cell, "\n", " ", -1)
+	cell = strings.TrimSpace(cell)
+
+	if maxWidth > 0 && utf8.RuneCountInString(cell) > maxWidth {
+		runes := []rune(cell)
+		if maxWidth > 1 {
+			cell = string(runes[:maxWidth-1]) + "…"
+		} else {
+			cell = string(runes[:maxWidth])
+		}
+	}
+
+	return strings.Replace(cell, "|", "\\|", -1)
+}
+
+func markdownRow(cells []string) string {
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+// renderTableMessages reads the table flags and renders the table as Markdown,
+// split into as many messages as it takes to stay under the post size limit.
+// Every message repeats the header, and the first starts with the message
+// flag.
+func renderTableMessages(cmd *cobra.Command, message string) ([]string, error) {
+	filename, _ := cmd.Flags().GetString("table")
+	format, _ := cmd.Flags().GetString("table-format")
+	columns, _ := cmd.Flags().GetString("columns")
+	align, _ := cmd.Flags().GetString("align")
+	decimals, _ := cmd.Flags().GetInt("decimals")
+	thousands, _ := cmd.Flags().GetBool("thousands")
+	maxWidth, _ := cmd.Flags().GetInt("max-width")
+
+	t, err := readTable(filename, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if columns != "" {
+		if err := t.selectColumns(strings.Split(columns, ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	var alignments []string
+	if align != "" {
+		alignments = strings.Split(align, ",")
+		if len(alignments) > len(t.header) {
+			return nil, fmt.Errorf("More alignments than columns")
+		}
+	}
+
+	separator := make([]string, len(t.header))
+	numeric := make([]bool, len(t.header))
+	for i := range t.header {
+		numeric[i] = t.isNumericColumn(i)
+
+		alignment := ALIGN_LEFT
+		if numeric[i] {
+			alignment = ALIGN_RIGHT
+		}
+		if i < len(alignments) && strings.TrimSpace(alignments[i]) != "" {
+			alignment = strings.TrimSpace(alignments[i])
+		}
+
+		switch alignment {
+		case ALIGN_LEFT:
+			separator[i] = ":---"
+		case ALIGN_RIGHT:
+			separator[i] = "---:"
+		case ALIGN_CENTER:
+			separator[i] = ":---:"
+		default:
+			return nil, fmt.Errorf("Unknown alignment: %v", alignment)
+		}
+	}
+
+	header := make([]string, len(t.header))
+	for i, name := range t.header {
+		header[i] = markdownCell(name, maxWidth)
+	}
+	head := markdownRow(header) + "\n" + markdownRow(separator) + "\n"
+
+	var messages []string
+	current := ""
+	if message != "" {
+		current = message + "\n\n"
+	}
+	current += head
+	rowsInCurrent := 0
+
+	for r, row := range t.rows {
+		cells := make([]string, len(t.header))
+		for i := range cells {
+			if i < len(row) {
+				cells[i] = row[i]
+			}
+			if numeric[i] {
+				cells[i] = formatNumber(cells[i], decimals, thousands)
+			}
+			cells[i] = markdownCell(cells[i], maxWidth)
+		}
+		line := markdownRow(cells) + "\n"
+
+		if utf8.RuneCountInString(current)+utf8.RuneCountInString(line) > model.POST_MESSAGE_MAX_RUNES {
+			if rowsInCurrent == 0 {
+				return nil, fmt.Errorf("Table row %v is too long to post, try --max-width", r+1)
+			}
+			messages = append(messages, strings.TrimSuffix(current, "\n"))
+			current = head
+			rowsInCurrent = 0
+		}
+
+		current += line
+		rowsInCurrent++
+	}
+	messages = append(messages, strings.TrimSuffix(current, "\n"))
+
+	return messages, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+func TestReadTables(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		data   string
+		header []string
+		rows   [][]string
+	}{
+		{
+			format: "csv",
+			data:   "name,count\n\"a, b\",1\nc\n",
+			header: []string{"name", "count"},
+			rows:   [][]string{{"a, b", "1"}, {"c"}},
+		},
+		{
+			format: "tsv",
+			data:   "name\tnote\nx\tsays \"hi\"\n",
+			header: []string{"name", "note"},
+			rows:   [][]string{{"x", `says "hi"`}},
+		},
+		{
+			format: "json",
+			data:   `[{"z":1,"a":"x"},{"a":null,"b":true,"c":{"d":[1]}}]`,
+			header: []string{"z", "a", "b", "c"},
+			rows:   [][]string{{"1", "x", "", ""}, {"", "", "true", `{"d":[1]}`}},
+		},
+		{
+			format: "json",
+			data:   `[["name","count"],["a",1.5],["b",null]]`,
+			header: []string{"name", "count"},
+			rows:   [][]string{{"a", "1.5"}, {"b", ""}},
+		},
+	} {
+		var table *table
+		var err error
+		switch test.format {
+		case "csv":
+			table, err = readDelimitedTable([]byte(test.data), ',')
+		case "tsv":
+			table, err = readDelimitedTable([]byte(test.data), '\t')
+		case "json":
+			table, err = readJsonTable([]byte(test.data))
+		}
+
+		if err != nil {
+			t.Errorf("%v %q: %v", test.format, test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(table.header, test.header) || !reflect.DeepEqual(table.rows, test.rows) {
+			t.Errorf("%v %q: got %q %q, want %q %q", test.format, test.data, table.header, table.rows, test.header, test.rows)
+		}
+	}
+
+	for _, data := range []string{"", "{}", "[]", "[1, 2]", `[{"a":1}, 2]`} {
+		if _, err := readJsonTable([]byte(data)); err == nil {
+			t.Errorf("json %q: got no error", data)
+		}
+	}
+	if _, err := readDelimitedTable([]byte(""), ','); err == nil {
+		t.Error("empty csv: got no error")
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	table := &table{
+		header: []string{"date", "signups", "revenue"},
+		rows:   [][]string{{"mon", "10", "1.5"}, {"tue"}},
+	}
+
+	if err := table.selectColumns([]string{"revenue", " 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"revenue", "date"}; !reflect.DeepEqual(table.header, want) {
+		t.Errorf("got header %v, want %v", table.header, want)
+	}
+	if want := [][]string{{"1.5", "mon"}, {"", "tue"}}; !reflect.DeepEqual(table.rows, want) {
+		t.Errorf("got rows %q, want %q", table.rows, want)
+	}
+
+	for _, column := range []string{"missing", "0", "3"} {
+		if err := table.selectColumns([]string{column}); err == nil {
+			t.Errorf("%v: got no error", column)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	for _, test := range []struct {
+		cell      string
+		decimals  int
+		thousands bool
+		formatted string
+	}{
+		{"1234567", -1, false, "1234567"},
+		{"1234567", -1, true, "1,234,567"},
+		{"-1234.5", -1, true, "-1,234.5"},
+		{"1234.5678", 2, true, "1,234.57"},
+		{"999", 0, true, "999"},
+		{"2.5", 0, false, "2"},
+		{" 42 ", -1, false, "42"},
+		{"1e6", -1, true, "1e6"},
+		{"", 2, true, ""},
+	} {
+		if formatted := formatNumber(test.cell, test.decimals, test.thousands); formatted != test.formatted {
+			t.Errorf("%q %v %v: got %q, want %q", test.cell, test.decimals, test.thousands, formatted, test.formatted)
+		}
+	}
+}
+
+func TestMarkdownCell(t *testing.T) {
+	for _, test := range []struct {
+		cell     string
+		maxWidth int
+		markdown string
+	}{
+		{"plain", 0, "plain"},
+		{"a|b", 0, `a\|b`},
+		{" two\r\nlines\n", 0, "two lines"},
+		{"héllo wörld", 5, "héll…"},
+		{"short", 5, "short"},
+		{"abc", 1, "a"},
+	} {
+		if markdown := markdownCell(test.cell, test.maxWidth); markdown != test.markdown {
+			t.Errorf("%q %v: got %q, want %q", test.cell, test.maxWidth, markdown, test.markdown)
+		}
+	}
+}
+
+func TestRenderTableMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "table-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	render := func(data string, args ...string) ([]string, error) {
+		filename := filepath.Join(dir, "table.csv")
+		if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("table", "", "")
+		cmd.Flags().String("table-format", "", "")
+		cmd.Flags().String("columns", "", "")
+		cmd.Flags().String("align", "", "")
+		cmd.Flags().Int("decimals", -1, "")
+		cmd.Flags().Bool("thousands", false, "")
+		cmd.Flags().Int("max-width", 0, "")
+		if err := cmd.ParseFlags(append([]string{"--table", filename}, args...)); err != nil {
+			t.Fatal(err)
+		}
+
+		return renderTableMessages(cmd, "KPIs")
+	}
+
+	messages, err := render("day,signups,note\nmon,1200,ok\ntue,,a|b\n", "--thousands", "--align", ",,center")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "KPIs\n\n| day | signups | note |\n| :--- | ---: | :---: |\n| mon | 1,200 | ok |\n| tue |  | a\\|b |"
+	if len(messages) != 1 || messages[0] != want {
+		t.Errorf("got %q, want %q", messages, want)
+	}
+
+	// Long tables are split into posts that each repeat the header
+	var rows strings.Builder
+	rows.WriteString("n,text\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&rows, "%v,%v\n", i, strings.Repeat("x", 40))
+	}
+	messages, err = render(rows.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) < 2 {
+		t.Fatalf("got %v messages, want the table split", len(messages))
+	}
+	count := 0
+	for i, message := range messages {
+		if utf8.RuneCountInString(message) > model.POST_MESSAGE_MAX_RUNES {
+			t.Errorf("message %v is too long", i+1)
+		}
+		lines := strings.Split(message, "\n")
+		if i != 0 {
+			lines = append([]string{"KPIs", ""}, lines...)
+		}
+		if lines[2] != "| n | text |" || lines[3] != "| ---: | :--- |" {
+			t.Errorf("message %v doesn't start with the header: %q", i+1, lines[:4])
+		}
+		count += len(lines) - 4
+	}
+	if count != 200 {
+		t.Errorf("got %v rows, want 200", count)
+	}
+
+	for _, args := range [][]string{{"--align", "left,up"}, {"--align", "left,left,left,left"}, {"--columns", "nope"}} {
+		if _, err := render("a,b,c\n1,2,3\n", args...); err == nil {
+			t.Errorf("%v: got no error", args)
+		}
+	}
+	if _, err := render("a\n" + strings.Repeat("x", model.POST_MESSAGE_MAX_RUNES) + "\n"); err == nil {
+		t.Error("long row: got no error")
+	}
+}
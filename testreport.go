@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+// testReport is the combined result of the JUnit and TAP reports.
+type testReport struct {
+	passed   int
+	failed   int
+	skipped  int
+	failures []*testFailure
+}
+
+type testFailure struct {
+	name    string
+	message string
+}
+
+type junitSuite struct {
+	Suites []*junitSuite `xml:"testsuite"`
+	Cases  []*junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// maxFailureMessage is the longest failure message shown for a test.
+const maxFailureMessage = 300
+
+var (
+	tapResultRegexp     = regexp.MustCompile(`^(not ok|ok)\b\s*(\d+)?\s*-?\s*([^#]*)(?:#\s*(\w+)\b\s*(.*))?$`)
+	tapDiagnosticRegexp = regexp.MustCompile(`^\s*(message|error|reason):\s*(.*)$`)
+	tapPlanRegexp       = regexp.MustCompile(`^\d+\.\.\d+`)
+	tapSummaryRegexp    = regexp.MustCompile(`^#\s*(tests|pass|fail|skip|todo|ok)\b\s*\d*\s*$`)
+)
+
+// expandReportPatterns expands the glob patterns given for report files, so
+// --junit 'results/*.xml' works even where the shell doesn't expand it.
+func expandReportPatterns(patterns []string) ([]string, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		if pattern == "-" {
+			filenames = append(filenames, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid report pattern %v: %v", pattern, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No reports found for %v", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+func readReport(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// addJunit adds the results of a JUnit XML report, which has either a
+// testsuites or a testsuite root.
+func (r *testReport) addJunit(data []byte) error {
+	suite := &junitSuite{}
+	if err := xml.Unmarshal(data, suite); err != nil {
+		return err
+	}
+	r.addJunitSuite(suite)
+	return nil
+}
+
+func (r *testReport) addJunitSuite(suite *junitSuite) {
+	for _, child := range suite.Suites {
+		r.addJunitSuite(child)
+	}
+
+	for _, testCase := range suite.Cases {
+		name := testCase.Name
+		if testCase.ClassName != "" {
+			name = testCase.ClassName + "." + name
+		}
+
+		failure := testCase.Failure
+		if failure == nil {
+			failure = testCase.Error
+		}
+
+		switch {
+		case failure != nil:
+			message := failure.Message
+			if message == "" {
+				message = failure.Text
+			}
+			r.addFailure(name, message)
+		case testCase.Skipped != nil:
+			r.skipped++
+		default:
+			r.passed++
+		}
+	}
+}
+
+// addTap adds the results of a Test Anything Protocol report. Failure messages
+// come from the YAML diagnostics after a failed test, or the comments after it
+// up to the next test or plan line. Summary comments like "# tests 2" are
+// never messages.
+func (r *testReport) addTap(data []byte) error {
+	var last *testFailure
+	inYaml := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if last != nil {
+			switch {
+			case trimmed == "---":
+				inYaml = true
+				continue
+			case trimmed == "...":
+				inYaml = false
+				continue
+			case inYaml:
+				if match := tapDiagnosticRegexp.FindStringSubmatch(line); match != nil && last.message == "" {
+					last.message = strings.Trim(match[2], `"'`)
+				}
+				continue
+			case tapSummaryRegexp.MatchString(trimmed):
+				// Summaries like "# tests 2" end the results
+				last = nil
+				continue
+			case strings.HasPrefix(trimmed, "#"):
+				if last.message == "" {
+					last.message = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+				}
+				continue
+			}
+		}
+
+		if tapPlanRegexp.MatchString(trimmed) {
+			last = nil
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "Bail out!") {
+			r.addFailure("Bail out", strings.TrimSpace(strings.TrimPrefix(trimmed, "Bail out!")))
+			last = nil
+			continue
+		}
+
+		match := tapResultRegexp.FindStringSubmatch(trimmed)
+		if match == nil {
+			continue
+		}
+		last = nil
+		inYaml = false
+
+		name := strings.TrimSpace(match[3])
+		if name == "" {
+			name = "test " + match[2]
+		}
+
+		switch directive := strings.ToUpper(match[4]); {
+		case directive == "SKIP" || directive == "TODO":
+			r.skipped++
+		case match[1] == "ok":
+			r.passed++
+		default:
+			last = r.addFailure(name, "")
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (r *testReport) addFailure(name string, message string) *testFailure {
+	r.failed++
+	failure := &testFailure{name: name, message: message}
+	r.failures = append(r.failures, failure)
+	return failure
+}
+
+// attachment summarizes the report with the counts and the first failures.
+func (r *testReport) attachment(maxFailures int) *model.SlackAttachment {
+	color := "#2eb886"
+	if r.failed != 0 {
+		color = "#a30200"
+	} else if r.passed == 0 {
+		color = "#808080"
+	}
+
+	summary := fmt.Sprintf("%v passed, %v failed, %v skipped", r.passed, r.failed, r.skipped)
+
+	text := ""
+	if len(r.failures) != 0 {
+		var lines []string
+		for i, failure := range r.failures {
+			if i >= maxFailures {
+				lines = append(lines, fmt.Sprintf("... and %v more", len(r.failures)-maxFailures))
+				break
+			}
+
+			lines = append(lines, "FAIL "+failure.name)
+			message := strings.TrimSpace(failure.message)
+			if utf8.RuneCountInString(message) > maxFailureMessage {
+				message = string([]rune(message)[:maxFailureMessage-1]) + "…"
+			}
+			for _, line := range strings.Split(message, "\n") {
+				if strings.TrimSpace(line) != "" {
+					lines = append(lines, "    "+strings.TrimRight(line, " \t\r"))
+				}
+			}
+		}
+		text = codeBlock(strings.Join(lines, "\n"), "")
+	}
+
+	return &model.SlackAttachment{
+		Fallback: summary,
+		Color:    color,
+		Title:    "Test results",
+		Text:     text,
+		Fields: []*model.SlackAttachmentField{
+			{Title: "Passed", Value: r.passed, Short: true},
+			{Title: "Failed", Value: r.failed, Short: true},
+			{Title: "Skipped", Value: r.skipped, Short: true},
+		},
+	}
+}
+
+// readTestReports reads the reports from the --junit and --tap flags and
+// returns their summary, along with the report files to attach. Reports read
+// from stdin are attached from a temporary copy.
+func readTestReports(cmd *cobra.Command) (*model.SlackAttachment, []string, error) {
+	junitPatterns, _ := cmd.Flags().GetStringArray("junit")
+	tapPatterns, _ := cmd.Flags().GetStringArray("tap")
+	maxFailures, _ := cmd.Flags().GetInt("max-failures")
+
+	junitFiles, err := expandReportPatterns(junitPatterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	tapFiles, err := expandReportPatterns(tapPatterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &testReport{}
+	var attachments []string
+
+	read := func(filename string, add func([]byte) error, stdinName string) error {
+		data, err := readReport(filename)
+		if err != nil {
+			return err
+		}
+		if err := add(data); err != nil {
+			return fmt.Errorf("Unable to read test report %v: %v", filename, err.Error())
+		}
+
+		if filename == "-" {
+			if filename, err = tempAttachment(stdinName, data); err != nil {
+				return err
+			}
+		}
+		attachments = append(attachments, filename)
+		return nil
+	}
+
+	for _, filename := range junitFiles {
+		if err := read(filename, report.addJunit, "junit.xml"); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, filename := range tapFiles {
+		if err := read(filename, report.addTap, "results.tap"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return report.attachment(maxFailures), attachments, nil
+}
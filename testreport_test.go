@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddTap(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		report   string
+		passed   int
+		failed   int
+		skipped  int
+		failures []testFailure
+	}{
+		{
+			name: "results",
+			report: `TAP version 13
+1..4
+ok 1 - first
+not ok 2 - second
+ok 3 - third # SKIP not on this platform
+not ok 4 # TODO later
+`,
+			passed:   1,
+			failed:   1,
+			skipped:  2,
+			failures: []testFailure{{name: "second"}},
+		},
+		{
+			name: "yaml diagnostics",
+			report: `not ok 1 - parses
+  ---
+  message: "expected 2, got 3"
+  severity: fail
+  ...
+`,
+			failed:   1,
+			failures: []testFailure{{name: "parses", message: "expected 2, got 3"}},
+		},
+		{
+			name: "comment diagnostics",
+			report: `not ok 1 - parses
+# expected 2, got 3
+# at parse.js:10
+ok 2 - prints
+# not a message for test 1
+`,
+			passed:   1,
+			failed:   1,
+			failures: []testFailure{{name: "parses", message: "expected 2, got 3"}},
+		},
+		{
+			name: "summary comments",
+			report: `ok 1 - a
+not ok 2 - b
+# tests 2
+# pass  1
+# fail  1
+`,
+			passed:   1,
+			failed:   1,
+			failures: []testFailure{{name: "b"}},
+		},
+		{
+			name: "trailing plan",
+			report: `not ok 1 - a
+1..1
+# Looks like you failed 1 test of 1
+`,
+			failed:   1,
+			failures: []testFailure{{name: "a"}},
+		},
+		{
+			name: "unnamed and bail out",
+			report: `not ok 1
+Bail out! Database is down
+`,
+			failed:   2,
+			failures: []testFailure{{name: "test 1"}, {name: "Bail out", message: "Database is down"}},
+		},
+	} {
+		report := &testReport{}
+		if err := report.addTap([]byte(test.report)); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		if report.passed != test.passed || report.failed != test.failed || report.skipped != test.skipped {
+			t.Errorf("%v: got %v passed, %v failed, %v skipped, want %v, %v, %v", test.name,
+				report.passed, report.failed, report.skipped, test.passed, test.failed, test.skipped)
+		}
+
+		var failures []testFailure
+		for _, failure := range report.failures {
+			failures = append(failures, *failure)
+		}
+		if !reflect.DeepEqual(failures, test.failures) {
+			t.Errorf("%v: got failures %+v, want %+v", test.name, failures, test.failures)
+		}
+	}
+}
+
+func TestAddJunit(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		report   string
+		passed   int
+		failed   int
+		skipped  int
+		failures []testFailure
+	}{
+		{
+			name: "testsuite root",
+			report: `<testsuite name="unit">
+  <testcase classname="math" name="adds"/>
+  <testcase classname="math" name="divides">
+    <failure message="division by zero">stack</failure>
+  </testcase>
+  <testcase name="later"><skipped/></testcase>
+</testsuite>`,
+			passed:   1,
+			failed:   1,
+			skipped:  1,
+			failures: []testFailure{{name: "math.divides", message: "division by zero"}},
+		},
+		{
+			name: "nested testsuites",
+			report: `<testsuites>
+  <testsuite name="a">
+    <testsuite name="b">
+      <testcase name="errors"><error>panic: nil map</error></testcase>
+    </testsuite>
+    <testcase name="passes"/>
+  </testsuite>
+</testsuites>`,
+			passed:   1,
+			failed:   1,
+			failures: []testFailure{{name: "errors", message: "panic: nil map"}},
+		},
+	} {
+		report := &testReport{}
+		if err := report.addJunit([]byte(test.report)); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		if report.passed != test.passed || report.failed != test.failed || report.skipped != test.skipped {
+			t.Errorf("%v: got %v passed, %v failed, %v skipped, want %v, %v, %v", test.name,
+				report.passed, report.failed, report.skipped, test.passed, test.failed, test.skipped)
+		}
+
+		var failures []testFailure
+		for _, failure := range report.failures {
+			failures = append(failures, *failure)
+		}
+		if !reflect.DeepEqual(failures, test.failures) {
+			t.Errorf("%v: got failures %+v, want %+v", test.name, failures, test.failures)
+		}
+	}
+
+	if err := (&testReport{}).addJunit([]byte("not xml")); err == nil {
+		t.Error("invalid XML: got no error")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/platform/model"
+	"github.com/spf13/cobra"
+)
+
+var warnInsecure sync.Once
+
+// newTLSConfig builds the TLS settings from the certificate flags.
+func newTLSConfig(cmd *cobra.Command) (*tls.Config, error) {
+	caCert, _ := cmd.Flags().GetString("ca-cert")
+	clientCert, _ := cmd.Flags().GetString("client-cert")
+	clientKey, _ := cmd.Flags().GetString("client-key")
+	insecure, _ := cmd.Flags().GetBool("insecure-skip-verify")
+
+	config := &tls.Config{}
+
+	if caCert != "" {
+		data, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CA certificate: %v", err.Error())
+		}
+
+		// Trust the system roots too, so the flag can't break public servers
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates found in %v", caCert)
+		}
+		config.RootCAs = pool
+	}
+
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("Need both --client-cert and --client-key")
+		}
+
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load client certificate: %v", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if insecure {
+		warnInsecure.Do(func() {
+			fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is disabled. Anyone between you and the server can read and change your traffic, including your password.")
+		})
+		config.InsecureSkipVerify = true
+	}
+
+	return config, nil
+}
+
+// newProxy returns the proxy from the proxy flag, or the proxy from the
+// environment when the flag isn't set.
+func newProxy(cmd *cobra.Command) (func(*http.Request) (*url.URL, error), error) {
+	proxy, _ := cmd.Flags().GetString("proxy")
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proxy URL: %v", err.Error())
+	}
+
+	return http.ProxyURL(proxyUrl), nil
+}
+
+// newHTTPTransport builds the transport for API requests from the TLS,
+// proxy and timeout flags. The timeout applies to connecting and waiting for
+// each response, not to the time taken to send large uploads.
+func newHTTPTransport(cmd *cobra.Command) (*http.Transport, error) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	tlsConfig, err := newTLSConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := newProxy(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+	}, nil
+}
+
+// newWebSocketDialer builds a WebSocket dialer with the same TLS, proxy and
+// timeout settings as API requests.
+func newWebSocketDialer(cmd *cobra.Command) (*websocket.Dialer, error) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	tlsConfig, err := newTLSConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := newProxy(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocket.Dialer{
+		Proxy:            proxy,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: timeout,
+	}, nil
+}
+
+// dialWebSocket opens an authenticated WebSocket connection for the logged
+// in client. It does what model.NewWebSocketClient4 does, but with the dialer
+// from the flags instead of the default one.
+func dialWebSocket(cmd *cobra.Command, client *model.Client4) (*websocket.Conn, error) {
+	dialer, err := newWebSocketDialer(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	connectUrl := "ws" + strings.TrimPrefix(client.Url, "http") + model.API_URL_SUFFIX + "/websocket"
+
+	conn, _, err := dialer.Dial(connectUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect WebSocket: %v", err.Error())
+	}
+
+	challenge := &model.WebSocketRequest{
+		Seq:    1,
+		Action: model.WEBSOCKET_AUTHENTICATION_CHALLENGE,
+		Data:   map[string]interface{}{"token": client.AuthToken},
+	}
+	if err := conn.WriteJSON(challenge); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Unable to authenticate WebSocket: %v", err.Error())
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/platform/model"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var serveVcsCmd = &cobra.Command{
+	Use:   "vcs [server]",
+	Short: "Receive GitHub and GitLab webhooks and post the events",
+	Long: `Receive GitHub and GitLab webhooks and post the events.
+
+Point GitHub or GitLab webhooks at http://host:8067/ with the secret given to
+--secret. Pushes, pull and merge requests, issues and pipelines are posted, with
+the events for each pull or merge request threaded under its first post.`,
+	RunE: doServeVcsCmdF,
+}
+
+func init() {
+	serveVcsCmd.Flags().String("listen", ":8067", "Address to listen on")
+	serveVcsCmd.Flags().String("secret", "", "The webhook secret set in GitHub, or the secret token set in GitLab")
+	serveVcsCmd.Flags().String("routes", "", "TOML file of repositories and the channels to post their events to")
+	serveVcsCmd.Flags().String("state", "", "File to save the thread for each pull and merge request to, so threads survive restarts")
+	serveVcsCmd.Flags().Int("max-commits", 10, "The most commits to list for a push")
+
+	serveCmd.AddCommand(serveVcsCmd)
+}
+
+const (
+	VCS_PUSH         = "push"
+	VCS_PULL_REQUEST = "pull_request"
+	VCS_ISSUE        = "issue"
+	VCS_PIPELINE     = "pipeline"
+)
+
+// vcsRoutes sends events to channels by repository, like:
+//
+//	[[route]]
+//	repo = "platform/*"
+//	events = ["push", "pull_request"]
+//	team = "eng"
+//	channels = ["platform-dev"]
+type vcsRoutes struct {
+	Routes []*vcsRoute `toml:"route"`
+}
+
+type vcsRoute struct {
+	Repo     string   `toml:"repo"`
+	Events   []string `toml:"events"`
+	Team     string   `toml:"team"`
+	Channels []string `toml:"channels"`
+}
+
+func (route *vcsRoute) matches(event *vcsEvent) bool {
+	if route.Repo != "" {
+		if matched, _ := path.Match(route.Repo, event.repo); !matched {
+			return false
+		}
+	}
+
+	if len(route.Events) == 0 {
+		return true
+	}
+	for _, kind := range route.Events {
+		if kind == event.kind {
+			return true
+		}
+	}
+	return false
+}
+
+// vcsEvent is a GitHub or GitLab event ready to post.
+type vcsEvent struct {
+	kind       string
+	repo       string
+	message    string
+	attachment *model.SlackAttachment
+
+	// Events with the same thread key are posted in one thread
+	threadKey string
+}
+
+// vcsServer posts the webhooks it receives.
+type vcsServer struct {
+	session    *serveSession
+	secret     string
+	routes     []*vcsRoute
+	defaults   []*postTarget
+	stateFile  string
+	maxCommits int
+
+	// The root post of each thread in each channel
+	mutex   sync.Mutex
+	threads map[string]string
+}
+
+func doServeVcsCmdF(cmd *cobra.Command, args []string) error {
+	secret, _ := cmd.Flags().GetString("secret")
+	routesFile, _ := cmd.Flags().GetString("routes")
+	stateFile, _ := cmd.Flags().GetString("state")
+	maxCommits, _ := cmd.Flags().GetInt("max-commits")
+	channels, _ := cmd.Flags().GetStringArray("channel")
+	teamName, _ := cmd.Flags().GetString("team")
+
+	if len(args) < 1 {
+		return fmt.Errorf("Need a server URL")
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("Extra args")
+	}
+
+	if secret == "" {
+		return fmt.Errorf("Need a --secret to verify webhooks with")
+	}
+
+	server := &vcsServer{
+		secret:     secret,
+		stateFile:  stateFile,
+		maxCommits: maxCommits,
+		threads:    map[string]string{},
+	}
+
+	if routesFile != "" {
+		data, err := ioutil.ReadFile(routesFile)
+		if err != nil {
+			return err
+		}
+
+		var parsed vcsRoutes
+		if err := toml.Unmarshal(data, &parsed); err != nil {
+			return fmt.Errorf("Unable to read routes %v: %v", routesFile, err.Error())
+		}
+		for i, route := range parsed.Routes {
+			if len(route.Channels) == 0 {
+				return fmt.Errorf("Route %v in %v has no channels", i+1, routesFile)
+			}
+			if _, err := path.Match(route.Repo, ""); err != nil {
+				return fmt.Errorf("Invalid repo pattern in route %v: %v", i+1, err.Error())
+			}
+		}
+		server.routes = parsed.Routes
+	}
+
+	for _, channel := range channels {
+		server.defaults = append(server.defaults, &postTarget{Server: args[0], Team: teamName, Channel: channel})
+	}
+
+	if len(server.routes) == 0 && len(server.defaults) == 0 {
+		return fmt.Errorf("Need a channel or routes file")
+	}
+
+	if stateFile != "" {
+		data, err := ioutil.ReadFile(stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &server.threads); err != nil {
+				return fmt.Errorf("Unable to read state file %v: %v", stateFile, err.Error())
+			}
+		}
+	}
+
+	session, err := newServeSession(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	server.session = session
+
+	return listenAndServe(cmd, server)
+}
+
+func (s *vcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// GitHub payloads are at most 25MB
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 25*1024*1024))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var event *vcsEvent
+	if eventType := r.Header.Get("X-GitHub-Event"); eventType != "" {
+		if !verifyGitHubSignature(body, r.Header.Get("X-Hub-Signature-256"), s.secret) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if eventType == "ping" {
+			fmt.Fprintln(w, "pong")
+			return
+		}
+		event, err = parseGitHubEvent(eventType, body, s.maxCommits)
+	} else if eventType := r.Header.Get("X-Gitlab-Event"); eventType != "" {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(s.secret)) != 1 {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		event, err = parseGitLabEvent(body, s.maxCommits)
+	} else {
+		http.Error(w, "Not a GitHub or GitLab webhook", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event == nil {
+		fmt.Fprintln(w, "Ignored")
+		return
+	}
+
+	if err := s.postEvent(event); err != nil {
+		fmt.Println("Unable to post " + event.kind + " event for " + event.repo)
+		fmt.Println(" Error: " + err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+// verifyGitHubSignature checks the HMAC-SHA256 of the body GitHub signs
+// webhooks with.
+func verifyGitHubSignature(body []byte, signature string, secret string) bool {
+	const prefix = "sha256="
+	if !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature[len(prefix):])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// postEvent posts the event to the channels it routes to, replying in the
+// thread for its pull or merge request when there is one.
+func (s *vcsServer) postEvent(event *vcsEvent) error {
+	var targets []*postTarget
+	for _, route := range s.routes {
+		if route.matches(event) {
+			for _, channel := range route.Channels {
+				targets = append(targets, &postTarget{Server: s.session.server, Team: route.Team, Channel: channel})
+			}
+			break
+		}
+	}
+	if len(targets) == 0 {
+		targets = s.defaults
+	}
+
+	for _, target := range targets {
+		channel, err := s.session.lookupChannel(target.Channel, target.Team)
+		if err != nil {
+			return err
+		}
+
+		post := &model.Post{
+			ChannelId: channel.Id,
+			Message:   event.message,
+			Type:      model.POST_DEFAULT,
+		}
+		if event.attachment != nil {
+			addSlackAttachment(post, event.attachment)
+		}
+
+		if event.threadKey == "" {
+			if _, err := s.session.createPost(post, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Held while posting so two events for a new thread can't both
+		// become its root
+		s.mutex.Lock()
+		err = s.postInThread(event.threadKey+"\x00"+channel.Id, post)
+		s.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// postInThread posts as a reply to the thread's root, or as the root when the
+// thread is new. The caller holds the mutex.
+func (s *vcsServer) postInThread(key string, post *model.Post) error {
+	post.RootId = s.threads[key]
+
+	created, err := s.session.createPost(post, nil)
+	if post.RootId != "" && isInvalidRoot(err) {
+		// The root was deleted, so start the thread again
+		post.RootId = ""
+		created, err = s.session.createPost(post, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if post.RootId == "" {
+		s.threads[key] = created.Id
+		if s.stateFile != "" {
+			if err := s.saveThreads(); err != nil {
+				fmt.Println("Unable to save state file " + s.stateFile)
+				fmt.Println(" Error: " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// isInvalidRoot reports whether the server refused a reply because its root
+// post is gone. Other errors, like the server being down, keep the thread.
+func isInvalidRoot(err error) bool {
+	appErr, ok := err.(*model.AppError)
+	return ok && (appErr.StatusCode == http.StatusBadRequest || appErr.StatusCode == http.StatusNotFound)
+}
+
+func (s *vcsServer) saveThreads() error {
+	data, err := json.MarshalIndent(s.threads, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.stateFile, data)
+}
+
+// vcsCommit is a commit in a push, from either provider.
+type vcsCommit struct {
+	Id      string `json:"id"`
+	Message string `json:"message"`
+	Url     string `json:"url"`
+	Author  struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+// renderPush describes a push with its commits.
+func renderPush(user string, repo string, repoUrl string, ref string, total int, commits []*vcsCommit, compareUrl string, created bool, deleted bool, maxCommits int) string {
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	isTag := strings.HasPrefix(ref, "refs/tags/")
+	if isTag {
+		branch = strings.TrimPrefix(ref, "refs/tags/")
+	}
+
+	kind := "branch"
+	if isTag {
+		kind = "tag"
+	}
+	repoLink := "[" + repo + "](" + repoUrl + ")"
+
+	if deleted {
+		return fmt.Sprintf("**%v** deleted %v `%v` of %v", user, kind, branch, repoLink)
+	}
+	if isTag {
+		return fmt.Sprintf("**%v** pushed tag `%v` to %v", user, branch, repoLink)
+	}
+
+	plural := "commits"
+	if total == 1 {
+		plural = "commit"
+	}
+
+	message := fmt.Sprintf("**%v** pushed %v %v to `%v` of %v", user, total, plural, branch, repoLink)
+	if created {
+		message = fmt.Sprintf("**%v** created branch `%v` of %v with %v %v", user, branch, repoLink, total, plural)
+	}
+	if compareUrl != "" {
+		message += " ([compare](" + compareUrl + "))"
+	}
+
+	for i, commit := range commits {
+		if i >= maxCommits {
+			message += fmt.Sprintf("\n- and %v more", len(commits)-maxCommits)
+			break
+		}
+
+		subject := commit.Message
+		if newline := strings.Index(subject, "\n"); newline != -1 {
+			subject = subject[:newline]
+		}
+		shortId := commit.Id
+		if len(shortId) > 7 {
+			shortId = shortId[:7]
+		}
+		message += fmt.Sprintf("\n- [`%v`](%v) %v - %v", shortId, commit.Url, subject, commit.Author.Name)
+	}
+
+	return message
+}
+
+// pipelineCard shows a pipeline run, colored by how it finished.
+func pipelineCard(name string, url string, status string, branch string, sha string, user string) *model.SlackAttachment {
+	if len(sha) > 8 {
+		sha = sha[:8]
+	}
+
+	var fields []*model.SlackAttachmentField
+	for _, field := range []struct{ title, value string }{
+		{"Status", status},
+		{"Branch", branch},
+		{"Commit", sha},
+		{"Triggered by", user},
+	} {
+		if field.value != "" {
+			fields = append(fields, &model.SlackAttachmentField{Title: field.title, Value: field.value, Short: true})
+		}
+	}
+
+	return &model.SlackAttachment{
+		Fallback:  name + ": " + status,
+		Color:     ciStatusColors[strings.ToLower(status)],
+		Title:     name,
+		TitleLink: url,
+		Fields:    fields,
+	}
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+type githubRepository struct {
+	FullName string `json:"full_name"`
+	HtmlUrl  string `json:"html_url"`
+}
+
+// parseGitHubEvent renders the GitHub events that are posted, returning nil
+// for the others.
+func parseGitHubEvent(eventType string, body []byte, maxCommits int) (*vcsEvent, error) {
+	switch eventType {
+	case "push":
+		var push struct {
+			Ref        string           `json:"ref"`
+			Created    bool             `json:"created"`
+			Deleted    bool             `json:"deleted"`
+			Compare    string           `json:"compare"`
+			Commits    []*vcsCommit     `json:"commits"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &push); err != nil {
+			return nil, err
+		}
+
+		return &vcsEvent{
+			kind:    VCS_PUSH,
+			repo:    push.Repository.FullName,
+			message: renderPush(push.Sender.Login, push.Repository.FullName, push.Repository.HtmlUrl, push.Ref, len(push.Commits), push.Commits, push.Compare, push.Created, push.Deleted, maxCommits),
+		}, nil
+	case "pull_request":
+		var event struct {
+			Action      string `json:"action"`
+			Number      int    `json:"number"`
+			PullRequest struct {
+				Title   string     `json:"title"`
+				HtmlUrl string     `json:"html_url"`
+				Merged  bool       `json:"merged"`
+				User    githubUser `json:"user"`
+				Head    struct {
+					Ref string `json:"ref"`
+				} `json:"head"`
+				Base struct {
+					Ref string `json:"ref"`
+				} `json:"base"`
+			} `json:"pull_request"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		action := event.Action
+		switch action {
+		case "closed":
+			if event.PullRequest.Merged {
+				action = "merged"
+			}
+		case "synchronize":
+			action = "pushed to"
+		case "opened", "reopened", "ready_for_review", "converted_to_draft":
+		default:
+			// Labels, assignees and edits would drown out everything else
+			return nil, nil
+		}
+
+		pr := event.PullRequest
+		return &vcsEvent{
+			kind: VCS_PULL_REQUEST,
+			repo: event.Repository.FullName,
+			message: fmt.Sprintf("**%v** %v pull request [#%v %v](%v) in [%v](%v) (`%v` → `%v`)",
+				event.Sender.Login, strings.Replace(action, "_", " ", -1), event.Number, pr.Title, pr.HtmlUrl,
+				event.Repository.FullName, event.Repository.HtmlUrl, pr.Head.Ref, pr.Base.Ref),
+			threadKey: fmt.Sprintf("github/%v!%v", event.Repository.FullName, event.Number),
+		}, nil
+	case "issues":
+		var event struct {
+			Action string `json:"action"`
+			Issue  struct {
+				Number  int    `json:"number"`
+				Title   string `json:"title"`
+				HtmlUrl string `json:"html_url"`
+			} `json:"issue"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		switch event.Action {
+		case "opened", "closed", "reopened":
+		default:
+			return nil, nil
+		}
+
+		return &vcsEvent{
+			kind: VCS_ISSUE,
+			repo: event.Repository.FullName,
+			message: fmt.Sprintf("**%v** %v issue [#%v %v](%v) in [%v](%v)",
+				event.Sender.Login, event.Action, event.Issue.Number, event.Issue.Title, event.Issue.HtmlUrl,
+				event.Repository.FullName, event.Repository.HtmlUrl),
+		}, nil
+	case "workflow_run":
+		var event struct {
+			Action      string `json:"action"`
+			WorkflowRun struct {
+				Name       string     `json:"name"`
+				HtmlUrl    string     `json:"html_url"`
+				HeadBranch string     `json:"head_branch"`
+				HeadSha    string     `json:"head_sha"`
+				Conclusion string     `json:"conclusion"`
+				Actor      githubUser `json:"actor"`
+			} `json:"workflow_run"`
+			Repository githubRepository `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		// Only finished runs are worth a post
+		if event.Action != "completed" {
+			return nil, nil
+		}
+
+		run := event.WorkflowRun
+		return &vcsEvent{
+			kind:       VCS_PIPELINE,
+			repo:       event.Repository.FullName,
+			message:    fmt.Sprintf("Workflow **%v** on `%v` of [%v](%v): %v", run.Name, run.HeadBranch, event.Repository.FullName, event.Repository.HtmlUrl, run.Conclusion),
+			attachment: pipelineCard(run.Name, run.HtmlUrl, run.Conclusion, run.HeadBranch, run.HeadSha, run.Actor.Login),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebUrl            string `json:"web_url"`
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// parseGitLabEvent renders the GitLab events that are posted, returning nil
+// for the others.
+func parseGitLabEvent(body []byte, maxCommits int) (*vcsEvent, error) {
+	var kind struct {
+		ObjectKind string `json:"object_kind"`
+	}
+	if err := json.Unmarshal(body, &kind); err != nil {
+		return nil, err
+	}
+
+	switch kind.ObjectKind {
+	case "push", "tag_push":
+		var push struct {
+			Ref               string        `json:"ref"`
+			Before            string        `json:"before"`
+			After             string        `json:"after"`
+			UserUsername      string        `json:"user_username"`
+			TotalCommitsCount int           `json:"total_commits_count"`
+			Commits           []*vcsCommit  `json:"commits"`
+			Project           gitlabProject `json:"project"`
+		}
+		if err := json.Unmarshal(body, &push); err != nil {
+			return nil, err
+		}
+
+		created, deleted := isZeroSha(push.Before), isZeroSha(push.After)
+		compareUrl := ""
+		if !created && !deleted {
+			compareUrl = push.Project.WebUrl + "/-/compare/" + push.Before + "..." + push.After
+		}
+
+		return &vcsEvent{
+			kind:    VCS_PUSH,
+			repo:    push.Project.PathWithNamespace,
+			message: renderPush(push.UserUsername, push.Project.PathWithNamespace, push.Project.WebUrl, push.Ref, push.TotalCommitsCount, push.Commits, compareUrl, created, deleted, maxCommits),
+		}, nil
+	case "merge_request":
+		var event struct {
+			User             gitlabUser    `json:"user"`
+			Project          gitlabProject `json:"project"`
+			ObjectAttributes struct {
+				Iid          int    `json:"iid"`
+				Title        string `json:"title"`
+				Url          string `json:"url"`
+				Action       string `json:"action"`
+				SourceBranch string `json:"source_branch"`
+				TargetBranch string `json:"target_branch"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		mr := event.ObjectAttributes
+		action := map[string]string{
+			"open":     "opened",
+			"reopen":   "reopened",
+			"close":    "closed",
+			"merge":    "merged",
+			"approved": "approved",
+			"update":   "updated",
+		}[mr.Action]
+		if action == "" {
+			return nil, nil
+		}
+
+		return &vcsEvent{
+			kind: VCS_PULL_REQUEST,
+			repo: event.Project.PathWithNamespace,
+			message: fmt.Sprintf("**%v** %v merge request [!%v %v](%v) in [%v](%v) (`%v` → `%v`)",
+				event.User.Username, action, mr.Iid, mr.Title, mr.Url,
+				event.Project.PathWithNamespace, event.Project.WebUrl, mr.SourceBranch, mr.TargetBranch),
+			threadKey: fmt.Sprintf("gitlab/%v!%v", event.Project.PathWithNamespace, mr.Iid),
+		}, nil
+	case "issue":
+		var event struct {
+			User             gitlabUser    `json:"user"`
+			Project          gitlabProject `json:"project"`
+			ObjectAttributes struct {
+				Iid    int    `json:"iid"`
+				Title  string `json:"title"`
+				Url    string `json:"url"`
+				Action string `json:"action"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		issue := event.ObjectAttributes
+		action := map[string]string{
+			"open":   "opened",
+			"reopen": "reopened",
+			"close":  "closed",
+		}[issue.Action]
+		if action == "" {
+			return nil, nil
+		}
+
+		return &vcsEvent{
+			kind: VCS_ISSUE,
+			repo: event.Project.PathWithNamespace,
+			message: fmt.Sprintf("**%v** %v issue [#%v %v](%v) in [%v](%v)",
+				event.User.Username, action, issue.Iid, issue.Title, issue.Url,
+				event.Project.PathWithNamespace, event.Project.WebUrl),
+		}, nil
+	case "pipeline":
+		var event struct {
+			User             gitlabUser    `json:"user"`
+			Project          gitlabProject `json:"project"`
+			ObjectAttributes struct {
+				Id     int    `json:"id"`
+				Ref    string `json:"ref"`
+				Sha    string `json:"sha"`
+				Status string `json:"status"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+
+		// Only finished pipelines are worth a post
+		pipeline := event.ObjectAttributes
+		switch pipeline.Status {
+		case "success", "failed", "canceled":
+		default:
+			return nil, nil
+		}
+
+		name := fmt.Sprintf("Pipeline #%v", pipeline.Id)
+		url := fmt.Sprintf("%v/-/pipelines/%v", event.Project.WebUrl, pipeline.Id)
+		return &vcsEvent{
+			kind:       VCS_PIPELINE,
+			repo:       event.Project.PathWithNamespace,
+			message:    fmt.Sprintf("**%v** on `%v` of [%v](%v): %v", name, pipeline.Ref, event.Project.PathWithNamespace, event.Project.WebUrl, pipeline.Status),
+			attachment: pipelineCard(name, url, pipeline.Status, pipeline.Ref, pipeline.Sha, event.User.Username),
+		}, nil
+	}
+
+	return nil, nil
+}
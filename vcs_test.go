@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, test := range []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		valid     bool
+	}{
+		{"valid", body, signature, "secret", true},
+		{"wrong secret", body, signature, "other", false},
+		{"changed body", []byte(`{"zen":"Keep it simple."}`), signature, "secret", false},
+		{"missing prefix", body, signature[len("sha256="):], "secret", false},
+		{"sha1 header", body, "sha1=" + signature[len("sha256="):], "secret", false},
+		{"bad hex", body, "sha256=zz", "secret", false},
+		{"empty", body, "", "secret", false},
+		{"empty digest", body, "sha256=", "secret", false},
+	} {
+		if valid := verifyGitHubSignature(test.body, test.signature, test.secret); valid != test.valid {
+			t.Errorf("%v: got %v, want %v", test.name, valid, test.valid)
+		}
+	}
+}